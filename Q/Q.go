@@ -1,17 +1,23 @@
 // Package Q support query expressions
-// todo: 2.order by name asc/desc
 package Q
 
 import (
 	"strings"
 	"fmt"
 	"bytes"
+	"reflect"
 )
 
 type Caller interface {
 	Call(fieldName string, argsCollector []interface{}) (string, []interface{})
 }
 
+// Setter renders the new value of a field in UPDATE statements
+// it is used as a value of `FieldMap`
+type Setter interface {
+	Set(dialect Dialect, fieldName string, argsCollector []interface{}) (string, []interface{})
+}
+
 type ExprFn func() (string)
 
 type QExpr struct {
@@ -66,26 +72,67 @@ func LTE(v interface{}) Caller {
 	return &QExpr{v, " <= ?", 1}
 }
 
-func IN(v []interface{}) Caller {
-	return &QExpr{v, ExprFn(func()(string) {
-		// make string `IN (?,?,?,...)`
-		bn := len(v) * 2 + 1
-		b := make([]byte, bn)
-		copy(b[1:], bytes.Repeat([]byte{'?',','}, len(v)))
-		b[0], b[bn - 1] = '(', ')'
-		return strings.Join([]string{"IN", string(b)}, " ")
-	}), len(v)}
+// inExpr renders `field IN (?,?,?,...)`
+// an empty list matches nothing with IN and everything with NOT IN
+type inExpr struct {
+	values []interface{}
+	not    bool
+}
+
+var _ Caller = &inExpr{}
+
+func (p *inExpr) Call(fieldName string, argsCollector []interface{}) (string, []interface{}) {
+	if len(p.values) == 0 {
+		if p.not {
+			return "1 = 1", argsCollector
+		}
+		return "1 = 0", argsCollector
+	}
+	// make string `(?,?,?,...)`
+	bn := len(p.values) * 2 + 1
+	b := make([]byte, bn)
+	copy(b[1:], bytes.Repeat([]byte{'?',','}, len(p.values)))
+	b[0], b[bn - 1] = '(', ')'
+	op := "IN"
+	if p.not {
+		op = "NOT IN"
+	}
+	argsCollector = append(argsCollector, p.values...)
+	return strings.Join([]string{fieldName, op, string(b)}, " "), argsCollector
+}
+
+// toValues converts a slice or an array of any type to []interface{}
+// []byte and other values are taken as one value
+func toValues(v interface{}) []interface{} {
+	if v == nil {
+		return nil
+	}
+	if values, ok := v.([]interface{}); ok {
+		return values
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return []interface{}{v}
+	}
+	if rv.Type().Elem().Kind() == reflect.Uint8 {
+		return []interface{}{v}
+	}
+	values := make([]interface{}, rv.Len())
+	for i := range values {
+		values[i] = rv.Index(i).Interface()
+	}
+	return values
 }
 
-func NI(v []interface{}) Caller {
-	return &QExpr{v, ExprFn(func()(string) {
-		// make string `NOT IN (?,?,?,...)`
-		bn := len(v) * 2 + 1
-		b := make([]byte, bn)
-		copy(b[1:], bytes.Repeat([]byte{'?',','}, len(v)))
-		b[0], b[bn - 1] = '(', ')'
-		return strings.Join([]string{"NOT IN", string(b)}, " ")
-	}), len(v)}
+// IN matches values in `v`, `v` can be a slice of any type
+// such as []interface{}, []int64 or []string
+func IN(v interface{}) Caller {
+	return &inExpr{values:toValues(v)}
+}
+
+// NI matches values not in `v`, `v` can be a slice of any type
+func NI(v interface{}) Caller {
+	return &inExpr{values:toValues(v), not:true}
 }
 
 func IsNull() Caller {
@@ -106,18 +153,58 @@ func NotBetween(begin interface{}, end interface{}) Caller {
 	return &QExpr{v, " NOT BETWEEN ? AND ? ", 2}
 }
 
+// Like matches values containing `v`
+// wildcards in `v` are not escaped, use `Contains` for user input
 func Like(v string) Caller {
 	var val interface{}
 	val = fmt.Sprintf("%%%s%%", v)
 	return &QExpr{val, " LIKE ?", 1}
 }
 
+// NotLike matches values not containing `v`
+// wildcards in `v` are not escaped
 func NotLike(v string) Caller {
 	var val interface{}
 	val = fmt.Sprintf("%%%s%%", v)
 	return &QExpr{val, " NOT LIKE ?", 1}
 }
 
+// allExpr joins conditions on the same field with AND
+type allExpr struct {
+	callers []Caller
+}
+
+var _ DialectCaller = &allExpr{}
+
+func (p *allExpr) Call(fieldName string, argsCollector []interface{}) (string, []interface{}) {
+	return p.CallDialect(MySQL, fieldName, argsCollector)
+}
+
+func (p *allExpr) CallDialect(dialect Dialect, fieldName string, argsCollector []interface{}) (string, []interface{}) {
+	if len(p.callers) == 0 {
+		return "1 = 1", argsCollector
+	}
+	var blocks []string
+	var block string
+	for _, caller := range p.callers {
+		block, argsCollector = Render(caller, dialect, fieldName, argsCollector)
+		blocks = append(blocks, block)
+	}
+	if len(blocks) == 1 {
+		return blocks[0], argsCollector
+	}
+	return "(" + strings.Join(blocks, " AND ") + ")", argsCollector
+}
+
+// All combines more than one condition on the same field with AND
+//
+// Example:
+//   // (age >= ? AND age < ?)
+//   WhereMap{"age": Q.All(Q.GTE(18), Q.LT(65))}
+func All(callers ...Caller) Caller {
+	return &allExpr{callers: callers}
+}
+
 type Limit []int
 
 func (limit Limit) IsEmpty()bool  {
@@ -0,0 +1,37 @@
+package Q
+
+// Dialect names the sql flavour expressions are rendered for
+type Dialect string
+
+const (
+	MySQL    Dialect = "mysql"
+	Postgres Dialect = "postgres"
+	SQLite   Dialect = "sqlite"
+)
+
+// DialectOf guesses the dialect from a `database/sql` driver name
+// it returns MySQL if the driver is unknown
+func DialectOf(driverName string) Dialect {
+	switch driverName {
+	case "postgres", "pgx", "pq", "cloudsqlpostgres", "nrpostgres":
+		return Postgres
+	case "sqlite3", "sqlite", "nrsqlite3":
+		return SQLite
+	}
+	return MySQL
+}
+
+// DialectCaller is a `Caller` rendering differently per dialect,
+// `Call` renders it for MySQL
+type DialectCaller interface {
+	Caller
+	CallDialect(dialect Dialect, fieldName string, argsCollector []interface{}) (string, []interface{})
+}
+
+// Render calls `caller` for `dialect` if it supports dialects
+func Render(caller Caller, dialect Dialect, fieldName string, argsCollector []interface{}) (string, []interface{}) {
+	if dc, ok := caller.(DialectCaller); ok {
+		return dc.CallDialect(dialect, fieldName, argsCollector)
+	}
+	return caller.Call(fieldName, argsCollector)
+}
@@ -0,0 +1,232 @@
+package Q
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"strings"
+)
+
+// JSON operators work on MySQL JSON, Postgres JSONB and SQLite json1 columns.
+// Paths are written in the MySQL form `$.a.b[0]` (the `$.` prefix is optional)
+// and converted to text arrays `{a,b,0}` on Postgres.
+
+// jsonPath normalizes `path` to the `$.a.b[0]` form
+func jsonPath(path string) string {
+	if path == "" {
+		return "$"
+	}
+	if !strings.HasPrefix(path, "$") {
+		if strings.HasPrefix(path, "[") {
+			return "$" + path
+		}
+		return "$." + path
+	}
+	return path
+}
+
+// pgPath converts `path` to a Postgres text array literal `{"a","b","0"}`
+func pgPath(path string) string {
+	path = strings.TrimPrefix(jsonPath(path), "$")
+	var keys []string
+	for _, part := range strings.Split(path, ".") {
+		for part != "" {
+			i := strings.IndexByte(part, '[')
+			if i < 0 {
+				keys = append(keys, part)
+				break
+			}
+			if i > 0 {
+				keys = append(keys, part[:i])
+			}
+			j := strings.IndexByte(part[i:], ']')
+			if j < 0 {
+				keys = append(keys, part[i+1:])
+				break
+			}
+			keys = append(keys, part[i+1:i+j])
+			part = part[i+j+1:]
+		}
+	}
+	quoter := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	for i, key := range keys {
+		key = strings.Trim(key, `"`)
+		keys[i] = `"` + quoter.Replace(key) + `"`
+	}
+	return "{" + strings.Join(keys, ",") + "}"
+}
+
+// pathArg returns the path argument and its placeholder for `dialect`
+func pathArg(dialect Dialect, path string) (interface{}, string) {
+	if dialect == Postgres {
+		return pgPath(path), "CAST(? AS text[])"
+	}
+	return jsonPath(path), "?"
+}
+
+// jsonValue is an argument marshalled to JSON when it is sent to the driver
+type jsonValue struct {
+	v interface{}
+}
+
+var _ driver.Valuer = jsonValue{}
+
+func (p jsonValue) Value() (driver.Value, error) {
+	if raw, ok := p.v.(json.RawMessage); ok {
+		return string(raw), nil
+	}
+	b, err := json.Marshal(p.v)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// jsonExpr renders a JSON function on the field
+type jsonExpr struct {
+	render func(dialect Dialect, fieldName string, argsCollector []interface{}) (string, []interface{})
+}
+
+var _ DialectCaller = &jsonExpr{}
+
+func (p *jsonExpr) Call(fieldName string, argsCollector []interface{}) (string, []interface{}) {
+	return p.render(MySQL, fieldName, argsCollector)
+}
+
+func (p *jsonExpr) CallDialect(dialect Dialect, fieldName string, argsCollector []interface{}) (string, []interface{}) {
+	return p.render(dialect, fieldName, argsCollector)
+}
+
+// JSONPath applies `caller` to the value extracted at `path` (as text)
+//
+// Example:
+//   // JSON_UNQUOTE(JSON_EXTRACT(doc, ?)) = ?
+//   WhereMap{"doc": Q.JSONPath("$.author.name", Q.EQ("Rob"))}
+func JSONPath(path string, caller Caller) Caller {
+	return &jsonExpr{func(dialect Dialect, fieldName string, argsCollector []interface{}) (string, []interface{}) {
+		var expr string
+		arg, placeholder := pathArg(dialect, path)
+		switch dialect {
+		case Postgres:
+			expr = "(" + fieldName + " #>> " + placeholder + ")"
+		case SQLite:
+			expr = "json_extract(" + fieldName + ", " + placeholder + ")"
+		default:
+			expr = "JSON_UNQUOTE(JSON_EXTRACT(" + fieldName + ", " + placeholder + "))"
+		}
+		argsCollector = append(argsCollector, arg)
+		return Render(caller, dialect, expr, argsCollector)
+	}}
+}
+
+// JSONContains matches documents containing `v`, `v` is marshalled to JSON
+// unless it is a `json.RawMessage`.
+// SQLite has no containment, every member of `v` (key and value of an object,
+// element of an array) must be a member of the document, nested values must equal
+func JSONContains(v interface{}) Caller {
+	return &jsonExpr{func(dialect Dialect, fieldName string, argsCollector []interface{}) (string, []interface{}) {
+		var block string
+		switch dialect {
+		case Postgres:
+			block = fieldName + " @> CAST(? AS jsonb)"
+		case SQLite:
+			// keys of object members are text, others are array indexes or NULL
+			block = "NOT EXISTS (SELECT 1 FROM json_each(?) AS v WHERE NOT EXISTS (SELECT 1 FROM json_each(" +
+				fieldName + ") AS d WHERE d.value IS v.value AND (typeof(v.key) <> 'text' OR d.key = v.key)))"
+		default:
+			block = "JSON_CONTAINS(" + fieldName + ", ?)"
+		}
+		argsCollector = append(argsCollector, jsonValue{v})
+		return block, argsCollector
+	}}
+}
+
+// JSONHasKey matches documents having a value at `path`
+func JSONHasKey(path string) Caller {
+	return &jsonExpr{func(dialect Dialect, fieldName string, argsCollector []interface{}) (string, []interface{}) {
+		var block string
+		arg, placeholder := pathArg(dialect, path)
+		switch dialect {
+		case Postgres:
+			block = "(" + fieldName + " #> " + placeholder + ") IS NOT NULL"
+		case SQLite:
+			block = "json_type(" + fieldName + ", " + placeholder + ") IS NOT NULL"
+		default:
+			block = "JSON_CONTAINS_PATH(" + fieldName + ", 'one', " + placeholder + ")"
+		}
+		argsCollector = append(argsCollector, arg)
+		return block, argsCollector
+	}}
+}
+
+// JSONLength applies `caller` to the length of the array at `path`
+//
+// Example:
+//   // JSON_LENGTH(doc, ?) >= ?
+//   WhereMap{"doc": Q.JSONLength("$.tags", Q.GTE(2))}
+func JSONLength(path string, caller Caller) Caller {
+	return &jsonExpr{func(dialect Dialect, fieldName string, argsCollector []interface{}) (string, []interface{}) {
+		var expr string
+		arg, placeholder := pathArg(dialect, path)
+		switch dialect {
+		case Postgres:
+			expr = "jsonb_array_length(" + fieldName + " #> " + placeholder + ")"
+		case SQLite:
+			expr = "json_array_length(" + fieldName + ", " + placeholder + ")"
+		default:
+			expr = "JSON_LENGTH(" + fieldName + ", " + placeholder + ")"
+		}
+		argsCollector = append(argsCollector, arg)
+		return Render(caller, dialect, expr, argsCollector)
+	}}
+}
+
+// jsonSetter renders the new value of a JSON field in UPDATE statements
+type jsonSetter struct {
+	render func(dialect Dialect, fieldName string, argsCollector []interface{}) (string, []interface{})
+}
+
+var _ Setter = &jsonSetter{}
+
+func (p *jsonSetter) Set(dialect Dialect, fieldName string, argsCollector []interface{}) (string, []interface{}) {
+	return p.render(dialect, fieldName, argsCollector)
+}
+
+// JSONSet sets the value at `path` to `v` marshalled as JSON
+//
+// Example:
+//   // UPDATE t_book SET doc=JSON_SET(doc, ?, CAST(? AS JSON)) WHERE id = ?
+//   table.Update(FieldMap{"doc": Q.JSONSet("$.price", 10)}, WhereMap{"id": Q.EQ(1)})
+func JSONSet(path string, v interface{}) Setter {
+	return &jsonSetter{func(dialect Dialect, fieldName string, argsCollector []interface{}) (string, []interface{}) {
+		var expr string
+		arg, placeholder := pathArg(dialect, path)
+		switch dialect {
+		case Postgres:
+			expr = "jsonb_set(" + fieldName + ", " + placeholder + ", CAST(? AS jsonb))"
+		case SQLite:
+			expr = "json_set(" + fieldName + ", " + placeholder + ", json(?))"
+		default:
+			expr = "JSON_SET(" + fieldName + ", " + placeholder + ", CAST(? AS JSON))"
+		}
+		argsCollector = append(argsCollector, arg, jsonValue{v})
+		return expr, argsCollector
+	}}
+}
+
+// JSONRemove removes the value at `path`
+func JSONRemove(path string) Setter {
+	return &jsonSetter{func(dialect Dialect, fieldName string, argsCollector []interface{}) (string, []interface{}) {
+		var expr string
+		arg, placeholder := pathArg(dialect, path)
+		switch dialect {
+		case Postgres:
+			expr = fieldName + " #- " + placeholder
+		case SQLite:
+			expr = "json_remove(" + fieldName + ", " + placeholder + ")"
+		default:
+			expr = "JSON_REMOVE(" + fieldName + ", " + placeholder + ")"
+		}
+		argsCollector = append(argsCollector, arg)
+		return expr, argsCollector
+	}}
+}
@@ -0,0 +1,84 @@
+package Q
+
+import (
+	"strings"
+)
+
+// likeEscaper escapes wildcards of user input with '!',
+// which needs no escaping in string literals of any dialect
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// likeExpr renders `field LIKE ?` with optional ESCAPE clause
+// and case folding
+type likeExpr struct {
+	pattern string
+	escaped bool
+	fold    bool
+}
+
+var _ DialectCaller = &likeExpr{}
+
+func (p *likeExpr) Call(fieldName string, argsCollector []interface{}) (string, []interface{}) {
+	return p.CallDialect(MySQL, fieldName, argsCollector)
+}
+
+func (p *likeExpr) CallDialect(dialect Dialect, fieldName string, argsCollector []interface{}) (string, []interface{}) {
+	op, field, placeholder := "LIKE", fieldName, "?"
+	if p.fold {
+		if dialect == Postgres {
+			op = "ILIKE"
+		}else {
+			field, placeholder = "LOWER(" + fieldName + ")", "LOWER(?)"
+		}
+	}
+	block := strings.Join([]string{field, op, placeholder}, " ")
+	if p.escaped {
+		block += " ESCAPE '!'"
+	}
+	argsCollector = append(argsCollector, p.pattern)
+	return block, argsCollector
+}
+
+// StartsWith matches values beginning with `v`
+// wildcards `%` and `_` in `v` are escaped
+func StartsWith(v string) Caller {
+	return &likeExpr{pattern:likeEscaper.Replace(v) + "%", escaped:true}
+}
+
+// EndsWith matches values ending with `v`
+// wildcards `%` and `_` in `v` are escaped
+func EndsWith(v string) Caller {
+	return &likeExpr{pattern:"%" + likeEscaper.Replace(v), escaped:true}
+}
+
+// Contains matches values containing `v`
+// wildcards `%` and `_` in `v` are escaped
+func Contains(v string) Caller {
+	return &likeExpr{pattern:"%" + likeEscaper.Replace(v) + "%", escaped:true}
+}
+
+// LikePattern matches values with the raw LIKE `pattern`
+func LikePattern(pattern string) Caller {
+	return &likeExpr{pattern:pattern}
+}
+
+// IStartsWith is the case-insensitive version of `StartsWith`
+// it renders ILIKE on Postgres and LOWER() on others
+func IStartsWith(v string) Caller {
+	return &likeExpr{pattern:likeEscaper.Replace(v) + "%", escaped:true, fold:true}
+}
+
+// IEndsWith is the case-insensitive version of `EndsWith`
+func IEndsWith(v string) Caller {
+	return &likeExpr{pattern:"%" + likeEscaper.Replace(v), escaped:true, fold:true}
+}
+
+// IContains is the case-insensitive version of `Contains`
+func IContains(v string) Caller {
+	return &likeExpr{pattern:"%" + likeEscaper.Replace(v) + "%", escaped:true, fold:true}
+}
+
+// ILikePattern is the case-insensitive version of `LikePattern`
+func ILikePattern(pattern string) Caller {
+	return &likeExpr{pattern:pattern, fold:true}
+}
@@ -0,0 +1,185 @@
+package Q
+
+import (
+	"strings"
+)
+
+// MatchMode is the search mode of full-text predicates
+type MatchMode int
+
+const (
+	// NaturalMode searches plain words
+	NaturalMode MatchMode = iota
+	// BooleanMode searches with operators of the dialect
+	// (`+word -word` on MySQL, `word & !word` on Postgres, FTS5 query syntax on SQLite)
+	BooleanMode
+)
+
+// splitColumns splits the field name "title,body" to columns
+func splitColumns(fieldName string) []string {
+	columns := strings.Split(fieldName, ",")
+	for i, column := range columns {
+		columns[i] = strings.TrimSpace(column)
+	}
+	return columns
+}
+
+// matchBlock renders the full-text predicate on the columns of `fieldName`
+func matchBlock(dialect Dialect, fieldName string, mode MatchMode) string {
+	columns := splitColumns(fieldName)
+	switch dialect {
+	case Postgres:
+		doc := columns[0]
+		if len(columns) > 1 {
+			doc = "concat_ws(' ', " + strings.Join(columns, ", ") + ")"
+		}
+		query := "plainto_tsquery(?)"
+		if mode == BooleanMode {
+			query = "to_tsquery(?)"
+		}
+		return "to_tsvector(" + doc + ") @@ " + query
+	case SQLite:
+		return fieldName + " MATCH ?"
+	default:
+		modeName := "NATURAL LANGUAGE"
+		if mode == BooleanMode {
+			modeName = "BOOLEAN"
+		}
+		return "MATCH (" + strings.Join(columns, ",") + ") AGAINST (? IN " + modeName + " MODE)"
+	}
+}
+
+// matchArg returns the search argument, natural searches are quoted as
+// words on SQLite so FTS5 operators in `query` are not interpreted
+func matchArg(dialect Dialect, query string, mode MatchMode) string {
+	if dialect != SQLite || mode == BooleanMode {
+		return query
+	}
+	var words []string
+	for _, word := range strings.Fields(query) {
+		words = append(words, `"` + strings.Replace(word, `"`, `""`, -1) + `"`)
+	}
+	return strings.Join(words, " ")
+}
+
+// matchExpr is the full-text predicate on one or more columns
+type matchExpr struct {
+	query string
+	mode  MatchMode
+}
+
+var _ DialectCaller = &matchExpr{}
+
+func (p *matchExpr) Call(fieldName string, argsCollector []interface{}) (string, []interface{}) {
+	return p.CallDialect(MySQL, fieldName, argsCollector)
+}
+
+func (p *matchExpr) CallDialect(dialect Dialect, fieldName string, argsCollector []interface{}) (string, []interface{}) {
+	argsCollector = append(argsCollector, matchArg(dialect, p.query, p.mode))
+	return matchBlock(dialect, fieldName, p.mode), argsCollector
+}
+
+// Match is the full-text search predicate,
+// the key can hold more than one column such as "title,body"
+// it renders `MATCH ... AGAINST` on MySQL, `to_tsvector @@ plainto_tsquery`
+// on Postgres and FTS5 `MATCH` on SQLite (the key is the FTS5 table or column)
+//
+// Example:
+//   // MATCH (title,body) AGAINST (? IN NATURAL LANGUAGE MODE)
+//   WhereMap{"title,body": Q.Match("golang sql", Q.NaturalMode)}
+func Match(query string, mode MatchMode) Caller {
+	return &matchExpr{query:query, mode:mode}
+}
+
+// Option is an extra clause of SELECT statements,
+// `Column`s are selected and `OrderBy` sorts rows
+type Option interface {
+	option()
+}
+
+// Column is an option selecting an expression rendered per dialect
+type Column interface {
+	Option
+	Column(dialect Dialect, argsCollector []interface{}) (string, []interface{})
+}
+
+// Matcher is a `Column` whose args are matched against table columns
+type Matcher interface {
+	Column
+	// Matched returns the columns matched ("a,b" for more columns)
+	Matched() string
+}
+
+// OrderBy sorts rows by the fields, "-name" sorts by name DESC
+//
+// Example:
+//   // ORDER BY score DESC, id
+//   Q.OrderBy{"-score", "id"}
+type OrderBy []string
+
+func (OrderBy) option() {}
+
+// Block renders the ORDER BY block, it is empty if no fields
+func (p OrderBy) Block() string {
+	if len(p) == 0 {
+		return ""
+	}
+	var fields []string
+	for _, field := range p {
+		if strings.HasPrefix(field, "-") {
+			fields = append(fields, field[1:] + " DESC")
+		}else {
+			fields = append(fields, field)
+		}
+	}
+	return "ORDER BY " + strings.Join(fields, ", ")
+}
+
+// matchScore selects the relevance of a full-text search
+type matchScore struct {
+	alias   string
+	columns string
+	query   string
+	mode    MatchMode
+}
+
+var _ Column = &matchScore{}
+
+func (*matchScore) option() {}
+
+func (p *matchScore) Matched() string {
+	return p.columns
+}
+
+func (p *matchScore) Column(dialect Dialect, argsCollector []interface{}) (string, []interface{}) {
+	columns := splitColumns(p.columns)
+	var expr string
+	switch dialect {
+	case Postgres:
+		block := matchBlock(dialect, p.columns, p.mode)
+		// `to_tsvector(doc) @@ query` => `ts_rank(to_tsvector(doc), query)`
+		expr = "ts_rank(" + strings.Replace(block, " @@ ", ", ", 1) + ")"
+		argsCollector = append(argsCollector, p.query)
+	case SQLite:
+		// FTS5 rank is lower for better matches
+		expr = "-rank"
+	default:
+		expr = matchBlock(dialect, strings.Join(columns, ","), p.mode)
+		argsCollector = append(argsCollector, p.query)
+	}
+	return expr + " AS " + p.alias, argsCollector
+}
+
+// MatchScore selects the relevance of the full-text search on `columns`
+// as `alias`, higher is better. Sort rows with `OrderBy{"-" + alias}`
+//
+// Example:
+//   // SELECT *, MATCH (title,body) AGAINST (? IN NATURAL LANGUAGE MODE) AS score
+//   // FROM t_book WHERE MATCH (title,body) AGAINST (? IN NATURAL LANGUAGE MODE)
+//   // ORDER BY score DESC
+//   BuildQuerySQL("t_book", WhereMap{"title,body": Q.Match("golang", Q.NaturalMode)},
+//       nil, Q.Limit{}, Q.MatchScore("score", "title,body", "golang", Q.NaturalMode),
+//       Q.OrderBy{"-score"})
+func MatchScore(alias string, columns string, query string, mode MatchMode) Column {
+	return &matchScore{alias:alias, columns:columns, query:query, mode:mode}
+}
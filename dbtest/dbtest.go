@@ -0,0 +1,258 @@
+// Package dbtest provisions databases for tests of `dbutils`:
+// every test gets a database with the schema applied and a transaction
+// rolled back after it, and runs once per registered provider.
+//
+// An ephemeral SQLite database is provided by default,
+// shared MySQL/Postgres databases can be registered by `RegisterFromEnv`.
+// The package never imports `dbutils` so tests of `dbutils` itself use it.
+package dbtest
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/argpass/dbutils/Q"
+	"github.com/jmoiron/sqlx"
+	_ "modernc.org/sqlite"
+)
+
+// Schema is the DDL of tables by dialect
+//
+// Example:
+//   var schema = dbtest.Schema{
+//       Create: map[Q.Dialect]string{
+//           Q.SQLite: `CREATE TABLE t_book(id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT)`,
+//           Q.MySQL:  `CREATE TABLE t_book(id INTEGER AUTO_INCREMENT PRIMARY KEY, name VARCHAR(100))`,
+//       },
+//       Drop: map[Q.Dialect]string{Q.MySQL: `DROP TABLE IF EXISTS t_book`},
+//   }
+type Schema struct {
+	// Create is the script creating tables
+	Create map[Q.Dialect]string
+	// Drop is the script dropping tables, it is run by shared databases
+	// before and after a test
+	Drop   map[Q.Dialect]string
+}
+
+// Provider provisions databases of a dialect
+type Provider interface {
+	// Name is the name of sub tests run by the provider
+	Name() string
+	// Open returns a database with `schema` applied, it is closed when `t` finishes
+	Open(t testing.TB, schema Schema) (*sqlx.DB, error)
+}
+
+var registry = struct {
+	sync.RWMutex
+	providers []Provider
+}{providers:[]Provider{SQLite()}}
+
+// Register adds providers tests run with
+func Register(providers ...Provider) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.providers = append(registry.providers, providers...)
+}
+
+// RegisterFromEnv registers shared databases of `DBUTILS_MYSQL_DSN` and `DBUTILS_POSTGRES_DSN`
+// if they are set, drivers "mysql" and "postgres" must be imported by the caller.
+// `DBUTILS_MYSQL_DNS` read by older tests is still accepted for MySQL
+func RegisterFromEnv() {
+	dsn := os.Getenv("DBUTILS_MYSQL_DSN")
+	if dsn == "" {
+		dsn = os.Getenv("DBUTILS_MYSQL_DNS")
+	}
+	if dsn != "" {
+		Register(DSN("mysql", "mysql", dsn))
+	}
+	if dsn := os.Getenv("DBUTILS_POSTGRES_DSN"); dsn != "" {
+		Register(DSN("postgres", "postgres", dsn))
+	}
+}
+
+// Providers returns registered providers
+func Providers() []Provider {
+	registry.RLock()
+	defer registry.RUnlock()
+	return append([]Provider(nil), registry.providers...)
+}
+
+// Run runs `fn` as a sub test of every registered provider
+// with a transaction rolled back after it,
+// providers of dialects `schema` doesn't create tables for are skipped
+//
+// Example:
+//   func TestInsert(t *testing.T) {
+//       dbtest.Run(t, schema, func(t *testing.T, tx *sqlx.Tx) {
+//           table := dbutils.NewSimpleTable(tx, "t_book")
+//           ...
+//       })
+//   }
+func Run(t *testing.T, schema Schema, fn func(t *testing.T, tx *sqlx.Tx)) {
+	for _, provider := range Providers() {
+		provider := provider
+		t.Run(provider.Name(), func(t *testing.T) {
+			fn(t, Begin(t, provider, schema))
+		})
+	}
+}
+
+// RunDB runs `fn` with the database as a sub test of every registered provider,
+// for tests managing transactions themselves
+func RunDB(t *testing.T, schema Schema, fn func(t *testing.T, db *sqlx.DB)) {
+	for _, provider := range Providers() {
+		provider := provider
+		t.Run(provider.Name(), func(t *testing.T) {
+			fn(t, Open(t, provider, schema))
+		})
+	}
+}
+
+// Open opens a database of `provider` with `schema` applied
+func Open(t testing.TB, provider Provider, schema Schema) *sqlx.DB {
+	t.Helper()
+	db, err := provider.Open(t, schema)
+	if err == errNoSchema {
+		t.Skipf("dbtest: no schema for %s", provider.Name())
+	}
+	if err != nil {
+		t.Fatalf("dbtest: fail to open %s, err:%v", provider.Name(), err)
+	}
+	return db
+}
+
+// Begin opens a database of `provider` and begins a transaction
+// rolled back when `t` finishes
+func Begin(t testing.TB, provider Provider, schema Schema) *sqlx.Tx {
+	t.Helper()
+	tx, err := Open(t, provider, schema).Beginx()
+	if err != nil {
+		t.Fatalf("dbtest: fail to begin %s, err:%v", provider.Name(), err)
+	}
+	t.Cleanup(func() {
+		tx.Rollback()
+	})
+	return tx
+}
+
+var errNoSchema = errors.New("no schema for the dialect")
+
+// script returns the script of the dialect of `db`
+func script(db *sqlx.DB, scripts map[Q.Dialect]string) string {
+	return scripts[Q.DialectOf(db.DriverName())]
+}
+
+// create runs the create script of `schema`
+func create(db *sqlx.DB, schema Schema) error {
+	create, ok := schema.Create[Q.DialectOf(db.DriverName())]
+	if !ok && len(schema.Create) > 0 {
+		return errNoSchema
+	}
+	return ExecScript(db, create)
+}
+
+type sqliteProvider struct{}
+
+// SQLite provides an ephemeral SQLite database per test
+func SQLite() Provider {
+	return sqliteProvider{}
+}
+
+func (sqliteProvider) Name() string {
+	return "sqlite"
+}
+
+func (sqliteProvider) Open(t testing.TB, schema Schema) (*sqlx.DB, error) {
+	db, err := sqlx.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		return nil, err
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+	if err = create(db, schema); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+type dsnProvider struct {
+	name       string
+	driverName string
+	dsn        string
+}
+
+// DSN provides a shared database, tables are dropped and created for every test.
+// Tests of a shared database ought not to run in parallel
+func DSN(name string, driverName string, dsn string) Provider {
+	return &dsnProvider{name:name, driverName:driverName, dsn:dsn}
+}
+
+func (p *dsnProvider) Name() string {
+	return p.name
+}
+
+func (p *dsnProvider) Open(t testing.TB, schema Schema) (*sqlx.DB, error) {
+	db, err := sqlx.Connect(p.driverName, p.dsn)
+	if err != nil {
+		return nil, err
+	}
+	drop := script(db, schema.Drop)
+	t.Cleanup(func() {
+		ExecScript(db, drop)
+		db.Close()
+	})
+	if err = ExecScript(db, drop); err != nil {
+		return nil, fmt.Errorf("drop: %v", err)
+	}
+	if err = create(db, schema); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// ExecScript runs statements of `script` separated by `;` one by one
+func ExecScript(db sqlx.Execer, script string) error {
+	for _, stmt := range Split(script) {
+		if _, err := db.Exec(stmt); err != nil {
+			return fmt.Errorf("%v: %s", err, stmt)
+		}
+	}
+	return nil
+}
+
+// Split splits `script` into statements by `;` out of quotes,
+// empty statements are left out
+func Split(script string) []string {
+	var stmts []string
+	var quote byte
+	start := 0
+	add := func(stmt string) {
+		for _, c := range stmt {
+			if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+				stmts = append(stmts, stmt)
+				return
+			}
+		}
+	}
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == ';':
+			add(script[start:i])
+			start = i + 1
+		}
+	}
+	add(script[start:])
+	return stmts
+}
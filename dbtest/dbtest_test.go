@@ -0,0 +1,35 @@
+package dbtest
+
+import (
+	"testing"
+
+	"github.com/argpass/dbutils/Q"
+	"github.com/jmoiron/sqlx"
+)
+
+var schema = Schema{
+	Create: map[Q.Dialect]string{
+		Q.SQLite: `CREATE TABLE t_book(id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT);
+		INSERT INTO t_book (name) VALUES ('a;b')`,
+	},
+}
+
+func TestSplit(t *testing.T) {
+	stmts := Split("CREATE TABLE a(x TEXT DEFAULT ';'); \n INSERT INTO a VALUES (\"b;\");\n")
+	if len(stmts) != 2 {
+		t.Fatalf("expect 2 statements, got %q", stmts)
+	}
+}
+
+func TestRun(t *testing.T) {
+	for i := 0; i < 2; i++ {
+		Run(t, schema, func(t *testing.T, tx *sqlx.Tx) {
+			// every run starts with the schema only
+			var count int
+			if err := tx.Get(&count, "SELECT COUNT(*) FROM t_book"); err != nil || count != 1 {
+				t.Fatalf("expect 1 row, got %d, err:%v", count, err)
+			}
+			tx.MustExec("INSERT INTO t_book (name) VALUES (?)", "golang")
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package evt
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// OverflowPolicy decides what to do with an event when the queue is full
+type OverflowPolicy int
+
+const (
+	// Drop drops the event and counts it
+	Drop OverflowPolicy = iota
+	// Block waits until the queue has room
+	Block
+)
+
+// AsyncOptions configures an `AsyncDispatcher`
+type AsyncOptions struct {
+	// QueueSize is the size of the queue of every subscriber, 1024 by default
+	QueueSize int
+	// Workers is the number of goroutines of every subscriber, 1 by default
+	Workers int
+	Policy OverflowPolicy
+	// Bus receives `HandlerErrorEvent` of failed handlers, the default bus if nil
+	Bus *Bus
+}
+
+type asyncQueue struct {
+	fn EventHandler
+	ch chan Event
+	// room is signaled when a worker takes an event, for blocked senders
+	room chan struct{}
+}
+
+// AsyncDispatcher runs handlers on worker goroutines,
+// every subscriber owns a bounded queue so a slow handler
+// never slows the sender
+//
+// Example:
+//   d := evt.NewAsyncDispatcher(evt.AsyncOptions{QueueSize: 100})
+//   defer d.Close()
+//   d.Subscribe((*dbutils.SQLEvent)(nil), func(e evt.Event) interface{} {
+//       log.Println(e.(*dbutils.SQLEvent).Query)
+//       return nil
+//   })
+type AsyncDispatcher struct {
+	opts    AsyncOptions
+	// lock is never held while blocking, senders only try to queue under it
+	lock    sync.RWMutex
+	closed  bool
+	done    chan struct{}
+	queues  []*asyncQueue
+	workers sync.WaitGroup
+	// pending counts events queued or being handled
+	pendingLock sync.Mutex
+	pendingCond *sync.Cond
+	pending     int
+	dropped     uint64
+	failed      uint64
+}
+
+// NewAsyncDispatcher creates an `AsyncDispatcher`
+func NewAsyncDispatcher(opts AsyncOptions) *AsyncDispatcher {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 1024
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	if opts.Bus == nil {
+		opts.Bus = Default()
+	}
+	d := &AsyncDispatcher{opts:opts, done:make(chan struct{})}
+	d.pendingCond = sync.NewCond(&d.pendingLock)
+	return d
+}
+
+// Handler wraps `fn` to a handler queuing events for `fn`,
+// the returned handler always returns nil.
+// `HandlerErrorEvent` of a failure of `fn` is sent to `AsyncOptions.Bus` with ID 0
+func (d *AsyncDispatcher) Handler(fn EventHandler) EventHandler {
+	q := &asyncQueue{fn:fn, ch:make(chan Event, d.opts.QueueSize), room:make(chan struct{}, 1)}
+	d.lock.Lock()
+	if d.closed {
+		close(q.ch)
+	}else {
+		d.queues = append(d.queues, q)
+		for i := 0; i < d.opts.Workers; i++ {
+			d.workers.Add(1)
+			go d.work(q)
+		}
+	}
+	d.lock.Unlock()
+	return func(e Event) (result interface{}) {
+		d.enqueue(q, e)
+		return nil
+	}
+}
+
+// Subscribe connects `fn` to the `event` type of the default bus,
+// `fn` runs asynchronously.
+// Use `bus.Subscribe(event, d.Handler(fn))` for other buses
+func (d *AsyncDispatcher) Subscribe(event Event, fn EventHandler) *Subscription {
+	return Subscribe(event, d.Handler(fn))
+}
+
+func (d *AsyncDispatcher) enqueue(q *asyncQueue, e Event) {
+	for {
+		queued, closed := d.tryEnqueue(q, e)
+		if queued {
+			return
+		}
+		if closed || d.opts.Policy != Block {
+			atomic.AddUint64(&d.dropped, 1)
+			return
+		}
+		// wait without the lock so `Close` and other senders go on
+		select {
+		case <-q.room:
+		case <-d.done:
+		}
+	}
+}
+
+// tryEnqueue queues `e` if the queue has room and the dispatcher is open
+func (d *AsyncDispatcher) tryEnqueue(q *asyncQueue, e Event) (queued bool, closed bool) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	if d.closed {
+		return false, true
+	}
+	d.addPending(1)
+	select {
+	case q.ch <- e:
+		return true, false
+	default:
+		d.addPending(-1)
+		return false, false
+	}
+}
+
+func (d *AsyncDispatcher) work(q *asyncQueue) {
+	defer d.workers.Done()
+	for e := range q.ch {
+		select {
+		case q.room <- struct{}{}:
+		default:
+		}
+		// a failed handler never stops the worker
+		if _, err := call(q.fn, e); err != nil {
+			atomic.AddUint64(&d.failed, 1)
+			if _, ok := e.(*HandlerErrorEvent); !ok {
+				d.opts.Bus.Send(&HandlerErrorEvent{Event:e, Err:err})
+			}
+		}
+		d.addPending(-1)
+	}
+}
+
+func (d *AsyncDispatcher) addPending(delta int) {
+	d.pendingLock.Lock()
+	d.pending += delta
+	if d.pending == 0 {
+		d.pendingCond.Broadcast()
+	}
+	d.pendingLock.Unlock()
+}
+
+// Flush waits until all queued events are handled
+func (d *AsyncDispatcher) Flush() {
+	d.pendingLock.Lock()
+	for d.pending > 0 {
+		d.pendingCond.Wait()
+	}
+	d.pendingLock.Unlock()
+}
+
+// Close stops accepting events, handles the queued ones and stops workers
+// events sent after closing are dropped
+func (d *AsyncDispatcher) Close() {
+	d.lock.Lock()
+	if d.closed {
+		d.lock.Unlock()
+		return
+	}
+	d.closed = true
+	close(d.done)
+	for _, q := range d.queues {
+		close(q.ch)
+	}
+	d.lock.Unlock()
+	d.workers.Wait()
+}
+
+// Dropped returns the number of events dropped
+func (d *AsyncDispatcher) Dropped() uint64 {
+	return atomic.LoadUint64(&d.dropped)
+}
+
+// Failed returns the number of events whose handler panicked or returned an error,
+// other values returned by handlers are not failures
+func (d *AsyncDispatcher) Failed() uint64 {
+	return atomic.LoadUint64(&d.failed)
+}
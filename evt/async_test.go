@@ -0,0 +1,119 @@
+package evt
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type asyncTestEvent struct {
+	n int
+}
+
+func TestAsyncDispatcher_Flush(t *testing.T) {
+	d := NewAsyncDispatcher(AsyncOptions{QueueSize:10, Workers:2, Policy:Block})
+	var sum int64
+	d.Subscribe((*asyncTestEvent)(nil), func(e Event) interface{} {
+		atomic.AddInt64(&sum, int64(e.(*asyncTestEvent).n))
+		return nil
+	})
+	for i := 1; i <= 100; i++ {
+		SynSend(&asyncTestEvent{n:i})
+	}
+	d.Flush()
+	if atomic.LoadInt64(&sum) != 5050 {
+		t.Fatalf("expect sum 5050 got %d", sum)
+	}
+	d.Close()
+	SynSend(&asyncTestEvent{n:1})
+	if d.Dropped() != 1 {
+		t.Fatalf("expect 1 dropped after close, got %d", d.Dropped())
+	}
+}
+
+func TestAsyncDispatcher_Drop(t *testing.T) {
+	d := NewAsyncDispatcher(AsyncOptions{QueueSize:1, Policy:Drop})
+	release := make(chan struct{})
+	started := make(chan struct{})
+	handler := d.Handler(func(e Event) interface{} {
+		if e.(*asyncTestEvent).n == 0 {
+			close(started)
+			<-release
+		}
+		return nil
+	})
+	handler(&asyncTestEvent{n:0})
+	<-started
+	// the worker is blocked: one event is queued, the others are dropped
+	for i := 1; i <= 3; i++ {
+		handler(&asyncTestEvent{n:i})
+	}
+	close(release)
+	d.Close()
+	if d.Dropped() != 2 {
+		t.Fatalf("expect 2 dropped, got %d", d.Dropped())
+	}
+}
+
+func TestAsyncDispatcher_CloseBlocked(t *testing.T) {
+	d := NewAsyncDispatcher(AsyncOptions{QueueSize:1, Policy:Block, Bus:NewBus()})
+	release := make(chan struct{})
+	started := make(chan struct{})
+	handler := d.Handler(func(e Event) interface{} {
+		if e.(*asyncTestEvent).n == 0 {
+			close(started)
+			<-release
+		}
+		return nil
+	})
+	handler(&asyncTestEvent{n:0})
+	<-started
+	handler(&asyncTestEvent{n:1})
+	// the queue is full, the producer blocks until the dispatcher is closed
+	produced := make(chan struct{})
+	go func() {
+		handler(&asyncTestEvent{n:2})
+		close(produced)
+	}()
+	closed := make(chan struct{})
+	go func() {
+		d.Close()
+		close(closed)
+	}()
+	select {
+	case <-produced:
+	case <-time.After(time.Second):
+		t.Fatalf("producer is still blocked after closing")
+	}
+	close(release)
+	<-closed
+	if d.Dropped() != 1 {
+		t.Fatalf("expect 1 dropped, got %d", d.Dropped())
+	}
+}
+
+func TestAsyncDispatcher_HandlerError(t *testing.T) {
+	bus := NewBus()
+	var errs []*HandlerErrorEvent
+	bus.Subscribe((*HandlerErrorEvent)(nil), func(e Event) interface{} {
+		errs = append(errs, e.(*HandlerErrorEvent))
+		return nil
+	})
+	d := NewAsyncDispatcher(AsyncOptions{Bus:bus})
+	handler := d.Handler(func(e Event) interface{} {
+		if e.(*asyncTestEvent).n == 1 {
+			panic("boom")
+		}
+		// values other than errors are no failures
+		return "ok"
+	})
+	handler(&asyncTestEvent{n:1})
+	handler(&asyncTestEvent{n:2})
+	d.Close()
+	if d.Failed() != 1 || len(errs) != 1 {
+		t.Fatalf("expect 1 failure, got %d, events:%v", d.Failed(), errs)
+	}
+	if _, ok := errs[0].Err.(*PanicError); !ok || errs[0].Event.(*asyncTestEvent).n != 1 {
+		t.Fatalf("bad error event:%+v", errs[0])
+	}
+}
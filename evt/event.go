@@ -1,73 +1,273 @@
 package evt
 
 import (
+	"fmt"
 	"reflect"
+	"runtime/debug"
+	"sort"
 	"sync"
+	"sync/atomic"
 )
 
 type Event interface {
 }
 
+// EventHandler handles an event, it fails if it panics or returns an `error` value,
+// any other value is just its result
 type EventHandler func(e Event) (result interface{})
 
 type EventType reflect.Type
 
-var registry = newRegistryDB()
+// PanicError is the error of a handler which panics
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("evt: handler panics: %v", e.Value)
+}
+
+// Result is the result of a handler
+type Result struct {
+	// ID is the id of the subscription
+	ID    uint64
+	Value interface{}
+	// Err is the error returned by the handler or a `*PanicError`
+	Err   error
+}
+
+// HandlerErrorEvent is sent when a handler fails (panics or returns an error),
+// it is not sent for failures of its own handlers
+type HandlerErrorEvent struct {
+	Event Event
+	// ID is the id of the failed subscription, 0 for handlers of an `AsyncDispatcher`
+	ID    uint64
+	Err   error
+	// Disabled is true if the handler is unsubscribed for failing too many times
+	Disabled bool
+}
 
-type registryDB struct {
+// call runs `fn` recovering panics,
+// a returned error value is taken as the error of `fn`
+func call(fn EventHandler, e Event) (value interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value:r, Stack:debug.Stack()}
+		}
+	}()
+	value = fn(e)
+	if failure, ok := value.(error); ok {
+		err = failure
+	}
+	return value, err
+}
+
+var registry = NewBus()
+
+// Bus is a registry connecting events with handlers,
+// package level functions use the default bus.
+// Create a new bus to keep events of tests or db clients apart
+type Bus struct {
 	sync.RWMutex
-	registryMap map[EventType][]EventHandler
+	registryMap map[EventType][]*Subscription
+	// interfaces are interface types having subscriptions
+	interfaces  []EventType
+	lastID      uint64
+	maxFailures int32
 }
 
-func newRegistryDB() *registryDB {
-	p := &registryDB{}
-	p.registryMap = map[EventType][]EventHandler{}
+// NewBus creates an empty `Bus`
+func NewBus() *Bus {
+	p := &Bus{}
+	p.registryMap = map[EventType][]*Subscription{}
 	return p
 }
 
+// Default returns the default bus used by package level functions
+func Default() *Bus {
+	return registry
+}
+
+// Subscription is a handler connected to an `EventType` of a bus
+type Subscription struct {
+	id      uint64
+	tp      EventType
+	handler EventHandler
+	bus     *Bus
+	// failures counts failures in a row
+	failures int32
+}
+
+// ID returns the id of the subscription, unique in its bus
+func (s *Subscription) ID() uint64 {
+	return s.id
+}
+
+// Unsubscribe disconnects the handler,
+// it is safe to call more than once
+func (s *Subscription) Unsubscribe() {
+	s.bus.unsubscribe(s)
+}
+
+// SetMaxFailures disables handlers failing `n` times in a row,
+// 0 (the default) never disables handlers
+func (re *Bus) SetMaxFailures(n int) {
+	re.Lock()
+	defer re.Unlock()
+	re.maxFailures = int32(n)
+}
+
 // Subscribe connects a `EventHandler` with to a `EventType`
-func (re *registryDB) Subscribe(event Event, handler EventHandler) {
+func (re *Bus) Subscribe(event Event, handler EventHandler) *Subscription {
+	return re.SubscribeType(EventType(reflect.ValueOf(event).Type()), handler)
+}
+
+// SubscribeType connects a `EventHandler` with `tp`,
+// handlers of an interface type receive all events implementing it
+//
+// Example:
+//   // handle events implementing `error`
+//   bus.SubscribeType(reflect.TypeOf((*error)(nil)).Elem(), handler)
+func (re *Bus) SubscribeType(tp EventType, handler EventHandler) *Subscription {
 	re.Lock()
 	defer re.Unlock()
 
-	tp := EventType(reflect.ValueOf(event).Type())
-	if s, ok := re.registryMap[tp]; ok {
-		s = append(s, handler)
-	}else{
-		re.registryMap[tp]=[]EventHandler{handler}
+	re.lastID++
+	sub := &Subscription{id:re.lastID, tp:tp, handler:handler, bus:re}
+	if _, ok := re.registryMap[tp]; !ok && tp.Kind() == reflect.Interface {
+		re.interfaces = append(re.interfaces, tp)
 	}
+	re.registryMap[tp] = append(re.registryMap[tp], sub)
+	return sub
 }
 
-// NotifyAll notifies handlers with the `event`
-func (re *registryDB) NotifyAll(event Event)(results []interface{}) {
-	re.RLock()
-	defer re.RUnlock()
+// SubscribeAll connects a `EventHandler` with all events
+func (re *Bus) SubscribeAll(handler EventHandler) *Subscription {
+	return re.SubscribeType(reflect.TypeOf((*Event)(nil)).Elem(), handler)
+}
 
+func (re *Bus) unsubscribe(sub *Subscription) {
+	re.Lock()
+	defer re.Unlock()
+
+	subs := re.registryMap[sub.tp]
+	for i, s := range subs {
+		if s == sub {
+			// copy on write, senders may be iterating the old slice
+			kept := make([]*Subscription, 0, len(subs) - 1)
+			kept = append(kept, subs[:i]...)
+			kept = append(kept, subs[i+1:]...)
+			if len(kept) == 0 {
+				delete(re.registryMap, sub.tp)
+				re.removeInterface(sub.tp)
+			}else {
+				re.registryMap[sub.tp] = kept
+			}
+			return
+		}
+	}
+}
+
+func (re *Bus) removeInterface(tp EventType) {
+	for i, iface := range re.interfaces {
+		if iface == tp {
+			re.interfaces = append(re.interfaces[:i:i], re.interfaces[i+1:]...)
+			return
+		}
+	}
+}
+
+// subscriptions returns subscriptions matching `tp` in subscribing order
+func (re *Bus) subscriptions(tp EventType) []*Subscription {
+	subs := re.registryMap[tp]
+	if len(re.interfaces) == 0 {
+		return subs
+	}
+	var matched []*Subscription
+	for _, iface := range re.interfaces {
+		if iface != tp && tp.Implements(iface) {
+			matched = append(matched, re.registryMap[iface]...)
+		}
+	}
+	if len(matched) == 0 {
+		return subs
+	}
+	matched = append(matched, subs...)
+	sort.Slice(matched, func(i, j int) bool {
+		return matched[i].id < matched[j].id
+	})
+	return matched
+}
+
+// Send notifies handlers with the `event` and returns their results
+// handlers are called without holding the lock,
+// so they can subscribe or send events themselves.
+// A failed handler never stops others, `HandlerErrorEvent` is sent for it
+func (re *Bus) Send(event Event) (results []Result) {
 	// get all handlers connected with the `event`
-	var ok = false
 	tp := EventType(reflect.ValueOf(event).Type())
-	_, ok = re.registryMap[tp]
-	if !ok {
+	re.RLock()
+	subs := re.subscriptions(tp)
+	maxFailures := re.maxFailures
+	re.RUnlock()
+	if len(subs) == 0 {
 		return results
 	}
 
 	// call all handlers on `event`, make results slice
-	for i, fn := range re.registryMap[tp] {
-		if results == nil {
-			results = make([]interface{}, len(re.registryMap))
+	results = make([]Result, len(subs))
+	for i, sub := range subs {
+		value, err := call(sub.handler, event)
+		results[i] = Result{ID:sub.id, Value:value, Err:err}
+		if err == nil {
+			atomic.StoreInt32(&sub.failures, 0)
+			continue
+		}
+		failures := atomic.AddInt32(&sub.failures, 1)
+		disabled := maxFailures > 0 && failures >= maxFailures
+		if disabled {
+			sub.Unsubscribe()
 		}
-		results[i] = fn(event)
+		if _, ok := event.(*HandlerErrorEvent); !ok {
+			re.Send(&HandlerErrorEvent{Event:event, ID:sub.id, Err:err, Disabled:disabled})
+		}
+	}
+	return results
+}
+
+// SynSend notifies handlers with the `event` and returns their results,
+// the result of a panicking handler is nil
+func (re *Bus) SynSend(event Event)(results []interface{}) {
+	rs := re.Send(event)
+	if rs == nil {
+		return results
+	}
+	results = make([]interface{}, len(rs))
+	for i, r := range rs {
+		results[i] = r.Value
 	}
 	return results
 }
 
-// Subscribe an `Event` to handle with fn
-func Subscribe(event Event, fn EventHandler) {
-	registry.Subscribe(event, fn)
+// Subscribe an `Event` to handle with fn on the default bus
+func Subscribe(event Event, fn EventHandler) *Subscription {
+	return registry.Subscribe(event, fn)
 }
 
 // SynSend sends event and get results from connected handlers
+// of the default bus
 func SynSend(event Event)([]interface{}){
-	return registry.NotifyAll(event)
+	return registry.SynSend(event)
 }
 
+// Send sends event and get typed results from connected handlers
+// of the default bus
+func Send(event Event) []Result {
+	return registry.Send(event)
+}
+
+// SetMaxFailures disables handlers of the default bus failing `n` times in a row
+func SetMaxFailures(n int) {
+	registry.SetMaxFailures(n)
+}
@@ -0,0 +1,118 @@
+package evt
+
+import (
+	"testing"
+)
+
+type busTestEvent struct{}
+
+func TestBus_Unsubscribe(t *testing.T) {
+	bus := NewBus()
+	called := 0
+	handler := func(e Event) interface{} {
+		called++
+		return called
+	}
+	sub1 := bus.Subscribe((*busTestEvent)(nil), handler)
+	sub2 := bus.Subscribe((*busTestEvent)(nil), handler)
+	if sub1.ID() == sub2.ID() {
+		t.Fatalf("expect different ids")
+	}
+	results := bus.SynSend(&busTestEvent{})
+	if len(results) != 2 || called != 2 {
+		t.Fatalf("expect 2 handlers called, got %v", results)
+	}
+
+	sub1.Unsubscribe()
+	sub1.Unsubscribe()
+	results = bus.SynSend(&busTestEvent{})
+	if len(results) != 1 || called != 3 {
+		t.Fatalf("expect 1 handler called, got %v", results)
+	}
+
+	// the default bus is not affected
+	if results = SynSend(&busTestEvent{}); len(results) != 0 {
+		t.Fatalf("expect no handler on default bus, got %v", results)
+	}
+}
+
+func TestBus_Panic(t *testing.T) {
+	bus := NewBus()
+	bus.SetMaxFailures(2)
+	var reported []*HandlerErrorEvent
+	bus.Subscribe((*HandlerErrorEvent)(nil), func(e Event) interface{} {
+		reported = append(reported, e.(*HandlerErrorEvent))
+		panic("the reporter fails too")
+	})
+	bad := bus.Subscribe((*busTestEvent)(nil), func(e Event) interface{} {
+		panic("boom")
+	})
+	bus.Subscribe((*busTestEvent)(nil), func(e Event) interface{} {
+		return "ok"
+	})
+
+	results := bus.Send(&busTestEvent{})
+	if len(results) != 2 || results[1].Value != "ok" {
+		t.Fatalf("expect the second handler called, got %v", results)
+	}
+	if _, ok := results[0].Err.(*PanicError); !ok || results[0].ID != bad.ID() {
+		t.Fatalf("expect panic error, got %v", results[0].Err)
+	}
+	if len(reported) != 1 || reported[0].ID != bad.ID() || reported[0].Disabled {
+		t.Fatalf("expect panic reported, got %v", reported)
+	}
+
+	bus.Send(&busTestEvent{})
+	if len(reported) != 2 || !reported[1].Disabled {
+		t.Fatalf("expect handler disabled, got %v", reported)
+	}
+	if results = bus.Send(&busTestEvent{}); len(results) != 1 {
+		t.Fatalf("expect 1 handler left, got %v", results)
+	}
+}
+
+type namedEvent interface {
+	Name() string
+}
+
+type namedTestEvent struct {
+	name string
+}
+
+func (e *namedTestEvent) Name() string {
+	return e.name
+}
+
+func TestOn(t *testing.T) {
+	bus := NewBus()
+	var got []string
+	On(bus, func(e *namedTestEvent) {
+		got = append(got, "typed:" + e.name)
+	})
+	sub := On(bus, func(e namedEvent) {
+		got = append(got, "iface:" + e.Name())
+	})
+	bus.SubscribeAll(func(e Event) interface{} {
+		got = append(got, "all")
+		return nil
+	})
+
+	bus.Send(&namedTestEvent{name:"a"})
+	bus.Send(&busTestEvent{})
+	expect := []string{"typed:a", "iface:a", "all", "all"}
+	if len(got) != len(expect) {
+		t.Fatalf("expect %v got %v", expect, got)
+	}
+	for i := range expect {
+		if got[i] != expect[i] {
+			t.Fatalf("expect %v got %v", expect, got)
+		}
+	}
+
+	sub.Unsubscribe()
+	got = nil
+	bus.Send(&namedTestEvent{name:"b"})
+	if len(got) != 2 {
+		t.Fatalf("expect interface handler removed, got %v", got)
+	}
+}
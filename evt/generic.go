@@ -0,0 +1,24 @@
+package evt
+
+import (
+	"reflect"
+)
+
+// On connects `fn` with events of type `T` on `bus` (the default bus if nil),
+// `T` can be an interface type to receive all events implementing it,
+// `On[Event]` receives all events
+//
+// Example:
+//   evt.On(nil, func(e *dbutils.SQLEvent) {
+//       fmt.Println("[SQL]:", e.Query)
+//   })
+func On[T any](bus *Bus, fn func(T)) *Subscription {
+	if bus == nil {
+		bus = registry
+	}
+	tp := reflect.TypeOf((*T)(nil)).Elem()
+	return bus.SubscribeType(tp, func(e Event) (result interface{}) {
+		fn(e.(T))
+		return nil
+	})
+}
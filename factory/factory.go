@@ -0,0 +1,239 @@
+// Package factory creates valid rows for tests on top of `dbutils.FieldMap`:
+// each factory defines default fields of a table by values or generators,
+// and rows are created with overrides
+package factory
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/argpass/dbutils"
+	"github.com/argpass/dbutils/internal/sorted"
+	"github.com/jmoiron/sqlx"
+)
+
+// Generator generates a field value of a new row
+type Generator func(f *Factory) (interface{}, error)
+
+// Fields are default fields of a factory,
+// values are either constant or `Generator`,
+// a func of other types is rejected when building, wrap it with `Func`
+type Fields map[string]interface{}
+
+type definition struct {
+	table  string
+	fields Fields
+}
+
+// Registry holds definitions of factories
+type Registry struct {
+	lock sync.Mutex
+	defs map[string]*definition
+	rand *rand.Rand
+}
+
+// NewRegistry creates an empty `Registry`,
+// random generators are seeded the same to make tests repeatable
+func NewRegistry() *Registry {
+	return &Registry{defs:map[string]*definition{}, rand:rand.New(rand.NewSource(1))}
+}
+
+var defaultRegistry = NewRegistry()
+
+// Default returns the registry used by package level functions
+func Default() *Registry {
+	return defaultRegistry
+}
+
+// Define defines factory `name` creating rows of `table` in the default registry
+func Define(name string, table string, fields Fields) {
+	defaultRegistry.Define(name, table, fields)
+}
+
+// Define defines factory `name` creating rows of `table`
+//
+// Example:
+//   registry.Define("author", "t_author", factory.Fields{
+//       "name": factory.Sequence("author-%d"),
+//   })
+//   registry.Define("book", "t_book", factory.Fields{
+//       "name":       factory.RandomString(8),
+//       "price":      9.9,
+//       "author_id":  factory.Ref("author"),
+//       "created_at": factory.Now(),
+//   })
+func (r *Registry) Define(name string, table string, fields Fields) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.defs[name] = &definition{table:table, fields:fields}
+}
+
+func (r *Registry) definition(name string) (*definition, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	def, ok := r.defs[name]
+	if !ok {
+		return nil, fmt.Errorf("no factory %s", name)
+	}
+	return def, nil
+}
+
+// Factory creates rows of factories by tables of a transaction
+type Factory struct {
+	registry *Registry
+	tx       *sqlx.Tx
+	// building are factories being built, to detect cyclic `Ref`
+	building map[string]bool
+}
+
+// New creates a `Factory` of the default registry creating rows by `tx`
+func New(tx *sqlx.Tx) *Factory {
+	return defaultRegistry.New(tx)
+}
+
+// New creates a `Factory` creating rows by `tx`
+func (r *Registry) New(tx *sqlx.Tx) *Factory {
+	return &Factory{registry:r, tx:tx, building:map[string]bool{}}
+}
+
+// Build returns fields of a row of factory `name` without inserting it,
+// `overrides` replace default fields and their generators are not called.
+// Rows referred to by `Ref` fields are still created by `tx`,
+// override those fields to build without touching the database
+func (f *Factory) Build(name string, overrides dbutils.FieldMap) (dbutils.FieldMap, error) {
+	def, err := f.registry.definition(name)
+	if err != nil {
+		return nil, err
+	}
+	return f.build(name, def, overrides)
+}
+
+func (f *Factory) build(name string, def *definition, overrides dbutils.FieldMap) (dbutils.FieldMap, error) {
+	if f.building[name] {
+		return nil, fmt.Errorf("cyclic references of factory %s", name)
+	}
+	f.building[name] = true
+	defer delete(f.building, name)
+	fields := dbutils.FieldMap{}
+	// generate in a stable order
+	for _, field := range sorted.Keys(def.fields) {
+		if _, ok := overrides[field]; ok {
+			continue
+		}
+		value := def.fields[field]
+		if value != nil && reflect.TypeOf(value).Kind() == reflect.Func {
+			if _, ok := value.(Generator); !ok {
+				return nil, fmt.Errorf("%s.%s: %T is no Generator, convert it or wrap it with factory.Func", name, field, value)
+			}
+		}
+		if generator, ok := value.(Generator); ok {
+			generated, err := generator(f)
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %v", name, field, err)
+			}
+			value = generated
+		}
+		fields[field] = value
+	}
+	for field, value := range overrides {
+		fields[field] = value
+	}
+	return fields, nil
+}
+
+// Create inserts a row of factory `name` with `overrides`
+// and returns its fields, "id" is set to the inserted id if it is not a field
+//
+// Example:
+//   book, err := factory.New(tx).Create("book", dbutils.FieldMap{"name": "X"})
+func (f *Factory) Create(name string, overrides dbutils.FieldMap) (dbutils.FieldMap, error) {
+	def, err := f.registry.definition(name)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := f.build(name, def, overrides)
+	if err != nil {
+		return nil, err
+	}
+	id, err := dbutils.NewSimpleTable(f.tx, def.table).Insert(fields)
+	if err != nil {
+		return nil, fmt.Errorf("create %s: %v", name, err)
+	}
+	if _, ok := fields["id"]; !ok {
+		fields["id"] = id
+	}
+	return fields, nil
+}
+
+// CreateMany inserts `n` rows of factory `name` with the same `overrides`
+func (f *Factory) CreateMany(name string, n int, overrides dbutils.FieldMap) ([]dbutils.FieldMap, error) {
+	var rows []dbutils.FieldMap
+	for i := 0; i < n; i++ {
+		row, err := f.Create(name, overrides)
+		if err != nil {
+			return rows, err
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// Sequence generates `format` with a number counting from 1,
+// the number itself if `format` is empty
+func Sequence(format string) Generator {
+	var lock sync.Mutex
+	var n int64
+	return func(f *Factory) (interface{}, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		n++
+		if format == "" {
+			return n, nil
+		}
+		return fmt.Sprintf(format, n), nil
+	}
+}
+
+const letters = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+// RandomString generates random strings of `n` lower case letters and digits
+func RandomString(n int) Generator {
+	return func(f *Factory) (interface{}, error) {
+		f.registry.lock.Lock()
+		defer f.registry.lock.Unlock()
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = letters[f.registry.rand.Intn(len(letters))]
+		}
+		return string(b), nil
+	}
+}
+
+// Now generates the current time in UTC truncated to seconds
+func Now() Generator {
+	return func(f *Factory) (interface{}, error) {
+		return time.Now().UTC().Truncate(time.Second), nil
+	}
+}
+
+// Ref creates a row of factory `name` and generates its id,
+// factories referring to each other fail instead of recursing forever
+func Ref(name string) Generator {
+	return func(f *Factory) (interface{}, error) {
+		row, err := f.Create(name, nil)
+		if err != nil {
+			return nil, err
+		}
+		return row["id"], nil
+	}
+}
+
+// Func generates values by `fn`
+func Func(fn func() interface{}) Generator {
+	return func(f *Factory) (interface{}, error) {
+		return fn(), nil
+	}
+}
@@ -0,0 +1,112 @@
+package factory
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/argpass/dbutils"
+	"github.com/argpass/dbutils/Q"
+	"github.com/argpass/dbutils/dbtest"
+	"github.com/jmoiron/sqlx"
+)
+
+var schema = dbtest.Schema{
+	Create: map[Q.Dialect]string{
+		Q.SQLite: `CREATE TABLE authors(id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL UNIQUE);
+		CREATE TABLE books(id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL, price REAL,
+			author_id INTEGER NOT NULL REFERENCES authors(id), created_at DATETIME)`,
+	},
+}
+
+func define(registry *Registry) {
+	registry.Define("author", "authors", Fields{"name":Sequence("author-%d")})
+	registry.Define("book", "books", Fields{
+		"name":RandomString(8),
+		"price":9.9,
+		"author_id":Ref("author"),
+		"created_at":Now(),
+	})
+}
+
+func TestFactory_Create(t *testing.T) {
+	dbtest.Run(t, schema, func(t *testing.T, tx *sqlx.Tx) {
+		// a registry of every provider, sequences of a registry go on across databases
+		registry := NewRegistry()
+		define(registry)
+		f := registry.New(tx)
+		book, err := f.Create("book", dbutils.FieldMap{"name":"X"})
+		if err != nil {
+			t.Fatalf("err:%v", err)
+		}
+		if book["name"] != "X" || book["id"] != int64(1) || book["author_id"] != int64(1) {
+			t.Fatalf("bad book:%v", book)
+		}
+		author, err := f.Create("author", nil)
+		if err != nil || author["name"] != "author-2" {
+			t.Fatalf("bad author %v, err:%v", author, err)
+		}
+		// the author is given, no author is created
+		if _, err = f.CreateMany("book", 2, dbutils.FieldMap{"author_id":author["id"]}); err != nil {
+			t.Fatalf("err:%v", err)
+		}
+		var count int
+		tx.Get(&count, "SELECT COUNT(*) FROM books WHERE author_id = ?", author["id"])
+		if count != 2 {
+			t.Fatalf("expect 2 books, got %d", count)
+		}
+		if _, err = f.Create("nope", nil); err == nil {
+			t.Fatalf("expect no factory")
+		}
+	})
+}
+
+func TestSequence_Shared(t *testing.T) {
+	registry := NewRegistry()
+	define(registry)
+	// factories of the same registry on different databases never repeat a sequence
+	seen := map[interface{}]bool{}
+	for _, f := range []*Factory{registry.New(nil), registry.New(nil)} {
+		for i := 0; i < 3; i++ {
+			author, err := f.Build("author", nil)
+			if err != nil {
+				t.Fatalf("err:%v", err)
+			}
+			if seen[author["name"]] {
+				t.Fatalf("sequence collision %v", author["name"])
+			}
+			seen[author["name"]] = true
+		}
+	}
+}
+
+func TestFactory_RefCycle(t *testing.T) {
+	registry := NewRegistry()
+	registry.Define("a", "a", Fields{"b_id":Ref("b")})
+	registry.Define("b", "b", Fields{"a_id":Ref("a")})
+	registry.Define("self", "self", Fields{"parent_id":Ref("self")})
+	f := registry.New(nil)
+	for _, name := range []string{"a", "self"} {
+		if _, err := f.Build(name, nil); err == nil || !strings.Contains(err.Error(), "cyclic") {
+			t.Fatalf("expect cyclic references of %s, got %v", name, err)
+		}
+	}
+	// the cycle is broken by overrides
+	registry.Define("c", "c", Fields{"parent_id":Ref("c")})
+	if _, err := f.Build("c", dbutils.FieldMap{"parent_id":nil}); err != nil {
+		t.Fatalf("err:%v", err)
+	}
+}
+
+func TestFactory_FuncField(t *testing.T) {
+	registry := NewRegistry()
+	registry.Define("raw", "t", Fields{"name":func() interface{} { return "x" }})
+	registry.Define("wrapped", "t", Fields{"name":Func(func() interface{} { return "x" })})
+	f := registry.New(nil)
+	if _, err := f.Build("raw", nil); err == nil {
+		t.Fatalf("expect error of a func field")
+	}
+	fields, err := f.Build("wrapped", nil)
+	if err != nil || fields["name"] != "x" {
+		t.Fatalf("bad fields %v, err:%v", fields, err)
+	}
+}
@@ -0,0 +1,134 @@
+package dbutils
+
+import (
+	"regexp"
+	"strings"
+	"github.com/argpass/dbutils/Q"
+)
+
+var (
+	// placeholderList matches `in (?,?,?)`, other calls like `lower(?)` are kept
+	placeholderList = regexp.MustCompile(`\b(in ?)\(\?(,\?)*\)`)
+	// placeholderRows matches `values (?,?),(?,?),...` of inserts
+	placeholderRows = regexp.MustCompile(`\b(values ?)\(\?(,\?)*\)(,\(\?(,\?)*\))*`)
+)
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '$' || c == '.' || c == '`' ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c >= 0x80
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// Fingerprint normalizes `query` to a stable form identifying the statement:
+// comments are removed, literals and placeholders become `?`,
+// lists of `IN (?,?,?)` and rows of `VALUES` collapse to `(?+)`,
+// whitespace is normalized and words are lower cased.
+// Double-quoted strings are literals as MySQL reads them without ANSI_QUOTES,
+// see `FingerprintFor`
+//
+// Example:
+//   // select * from t_book where id in (?+) and name = ?
+//   Fingerprint("SELECT * FROM t_book WHERE id IN (?,?,?) AND name = 'Go'")
+func Fingerprint(query string) string {
+	return FingerprintFor(Q.MySQL, query)
+}
+
+// FingerprintFor normalizes `query` of `dialect` like `Fingerprint`,
+// double-quoted strings are literals of MySQL and identifiers of others
+func FingerprintFor(dialect Q.Dialect, query string) string {
+	var b strings.Builder
+	space := false
+	emit := func(s string) {
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		space = false
+		b.WriteString(s)
+	}
+	n := len(query)
+	for i := 0; i < n; {
+		c := query[i]
+		switch {
+		case c == '/' && i + 1 < n && query[i+1] == '*':
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				i = n
+			}else {
+				i += end + 4
+			}
+			space = true
+		case c == '-' && i + 1 < n && query[i+1] == '-':
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				i = n
+			}else {
+				i += end
+			}
+			space = true
+		case c == '\'' || (c == '"' && dialect == Q.MySQL):
+			// string literal, doubled quotes and \' are escaped quotes
+			i++
+			for i < n {
+				if query[i] == '\\' {
+					i += 2
+					continue
+				}
+				if query[i] == c {
+					if i + 1 < n && query[i+1] == c {
+						i += 2
+						continue
+					}
+					break
+				}
+				i++
+			}
+			i++
+			emit("?")
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			space = true
+			i++
+		case c == '$' && i + 1 < n && isDigit(query[i+1]):
+			// postgres placeholder $1
+			i++
+			for i < n && isDigit(query[i]) {
+				i++
+			}
+			emit("?")
+		case isDigit(c):
+			// number literal, identifiers with digits are handled below
+			for i < n && (isIdentChar(query[i]) || ((query[i] == '+' || query[i] == '-') &&
+					(query[i-1] == 'e' || query[i-1] == 'E'))) {
+				i++
+			}
+			emit("?")
+		case isIdentChar(c):
+			start := i
+			for i < n && isIdentChar(query[i]) {
+				i++
+			}
+			emit(strings.ToLower(query[start:i]))
+		case c == ')':
+			space = false
+			emit(")")
+			i++
+		case c == '(' || c == ',':
+			if c == ',' {
+				space = false
+			}
+			emit(string(c))
+			i++
+			// no space after `(` and `,`
+			for i < n && (query[i] == ' ' || query[i] == '\t' || query[i] == '\n' || query[i] == '\r') {
+				i++
+			}
+		default:
+			emit(string(c))
+			i++
+		}
+	}
+	fingerprint := placeholderList.ReplaceAllString(b.String(), "${1}(?+)")
+	return placeholderRows.ReplaceAllString(fingerprint, "${1}(?+)")
+}
@@ -0,0 +1,55 @@
+package dbutils
+
+import (
+	"testing"
+	"github.com/argpass/dbutils/Q"
+)
+
+func TestFingerprint(t *testing.T) {
+	cases := map[string]string{
+		"SELECT * FROM t_book WHERE id IN (?,?,?) AND name = 'it''s'":
+			"select * from t_book where id in (?+) and name = ?",
+		"/* tag */ select  *\n FROM t_book WHERE id IN (1, 2) -- comment\n LIMIT 0, 10":
+			"select * from t_book where id in (?+) limit ?,?",
+		"INSERT INTO t1 (a,b) VALUES (?,?),(?,?),(?,?) ":
+			"insert into t1 (a,b) values (?+)",
+		"UPDATE t SET price=1.5e+3 WHERE id = $1":
+			"update t set price=? where id = ?",
+		"SELECT * FROM t WHERE LOWER(name) = LOWER(?) AND id NOT IN (?)":
+			"select * from t where lower(name) = lower(?) and id not in (?+)",
+		`SELECT * FROM t WHERE name = "it""s" AND tag = "a\"b"`:
+			"select * from t where name = ? and tag = ?",
+	}
+	for query, expect := range cases {
+		if got := Fingerprint(query); got != expect {
+			t.Fatalf("fingerprint of %q: expect %q got %q", query, expect, got)
+		}
+	}
+	if Fingerprint("SELECT * FROM t WHERE id IN (?)") != Fingerprint("SELECT * FROM t WHERE id IN (?,?)") {
+		t.Fatalf("expect IN lists collapsed")
+	}
+	if Fingerprint(`SELECT * FROM t WHERE name = "Go"`) != Fingerprint(`SELECT * FROM t WHERE name = 'Rust'`) {
+		t.Fatalf("expect double-quoted literals normalized")
+	}
+	// double quotes are identifiers of postgres
+	if got := FingerprintFor(Q.Postgres, `SELECT "name" FROM t WHERE id = $1`); got != `select "name" from t where id = ?` {
+		t.Fatalf("expect identifiers kept, got %q", got)
+	}
+}
+
+func TestBuildQuerySQL_Stable(t *testing.T) {
+	where := WhereMap{"a": nil, "b": nil, "c": nil, "d": nil}
+	for k := range where {
+		where[k] = Q.EQ(1)
+	}
+	first, _ := BuildQuerySQL("t_table", where, nil, Q.Limit{})
+	for i := 0; i < 20; i++ {
+		if query, _ := BuildQuerySQL("t_table", where, nil, Q.Limit{}); query != first {
+			t.Fatalf("expect stable query %s got %s", first, query)
+		}
+	}
+	query, _, _ := BuildUpdateSQL("t_table", FieldMap{"b": 1, "a": 2}, where)
+	if query != "UPDATE t_table SET a=?,b=? WHERE a  = ? AND b  = ? AND c  = ? AND d  = ?" {
+		t.Fatalf("bad query:%s", query)
+	}
+}
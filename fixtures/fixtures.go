@@ -0,0 +1,477 @@
+// Package fixtures loads rows of YAML/JSON files into tables by `dbutils.SimpleTable`
+//
+// A file is keyed by table names, rows of a table are labeled or listed,
+// `$table.label` refers to the id of a labeled row:
+//
+//   authors:
+//     alice:
+//       name: Alice
+//   books:
+//     - name: Go
+//       author_id: $authors.alice
+//
+// Tables are loaded in the order of references, a labeled row referred to
+// is inserted alone to get its id (unless it has an `id` field),
+// by `RETURNING id` on Postgres, other rows are inserted by `InsertMany`.
+// Rows of a table are inserted in file order, so a row may refer to
+// a row above it in its own table (e.g. `parent_id` of trees).
+// Maps and lists of a field are stored as JSON text, `$$` escapes a leading `$`.
+package fixtures
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/argpass/dbutils"
+	"github.com/argpass/dbutils/Q"
+	"github.com/argpass/dbutils/internal/sorted"
+	"github.com/jmoiron/sqlx"
+	"gopkg.in/yaml.v3"
+)
+
+// Row is a row of a fixture
+type Row struct {
+	// Label names the row for references, empty if the row is listed
+	Label  string
+	Fields dbutils.FieldMap
+}
+
+// ref is a reference `$table.label`
+type ref struct {
+	table string
+	label string
+}
+
+func (r ref) String() string {
+	return "$" + r.table + "." + r.label
+}
+
+// IDs are ids of labeled rows keyed by `table.label`
+type IDs map[string]interface{}
+
+// ID returns the id of the row `label` of `table`
+func (p IDs) ID(table string, label string) interface{} {
+	return p[table + "." + label]
+}
+
+// Options configures a `Loader`
+type Options struct {
+	// Truncate deletes all rows of the tables before loading
+	Truncate bool
+}
+
+// Loader loads fixtures into tables
+//
+// Example:
+//   loader := fixtures.New(fixtures.Options{Truncate: true})
+//   if err := loader.AddFiles("testdata/authors.yml", "testdata/books.json"); err != nil {
+//       t.Fatal(err)
+//   }
+//   ids, err := loader.Load(tx)
+//   aliceID := ids.ID("authors", "alice")
+type Loader struct {
+	opts   Options
+	tables map[string][]*Row
+}
+
+// New creates a `Loader`
+func New(opts Options) *Loader {
+	return &Loader{opts:opts, tables:map[string][]*Row{}}
+}
+
+// AddFiles adds fixtures of files, `.json` files are read as JSON and others as YAML
+func (l *Loader) AddFiles(paths ...string) error {
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if strings.EqualFold(filepath.Ext(path), ".json") {
+			err = l.AddJSON(data)
+		}else {
+			err = l.AddYAML(data)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	return nil
+}
+
+// AddYAML adds fixtures of a YAML document
+func (l *Loader) AddYAML(data []byte) error {
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return err
+	}
+	var doc map[string]interface{}
+	if err := node.Decode(&doc); err != nil {
+		return err
+	}
+	// labels in file order
+	labels := map[string][]string{}
+	if len(node.Content) > 0 && node.Content[0].Kind == yaml.MappingNode {
+		tables := node.Content[0].Content
+		for i := 0; i + 1 < len(tables); i += 2 {
+			if rows := tables[i + 1]; rows.Kind == yaml.MappingNode {
+				for j := 0; j < len(rows.Content); j += 2 {
+					labels[tables[i].Value] = append(labels[tables[i].Value], rows.Content[j].Value)
+				}
+			}
+		}
+	}
+	return l.add(doc, labels)
+}
+
+// AddJSON adds fixtures of a JSON document
+func (l *Loader) AddJSON(data []byte) error {
+	var doc map[string]interface{}
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return err
+	}
+	labels, err := jsonLabels(data)
+	if err != nil {
+		return err
+	}
+	return l.add(doc, labels)
+}
+
+// jsonLabels returns labels of tables in file order
+func jsonLabels(data []byte) (map[string][]string, error) {
+	labels := map[string][]string{}
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	// skip `{`
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	for dec.More() {
+		table, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		var rows json.RawMessage
+		if err = dec.Decode(&rows); err != nil {
+			return nil, err
+		}
+		rowsDec := json.NewDecoder(strings.NewReader(string(rows)))
+		if delim, _ := rowsDec.Token(); delim != json.Delim('{') {
+			continue
+		}
+		for rowsDec.More() {
+			label, err := rowsDec.Token()
+			if err != nil {
+				return nil, err
+			}
+			labels[table.(string)] = append(labels[table.(string)], label.(string))
+			var row json.RawMessage
+			if err = rowsDec.Decode(&row); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return labels, nil
+}
+
+// Add adds rows to `table`
+func (l *Loader) Add(table string, rows ...*Row) error {
+	for _, row := range rows {
+		if row.Label == "" {
+			continue
+		}
+		for _, existing := range l.tables[table] {
+			if existing.Label == row.Label {
+				return fmt.Errorf("duplicate row %s.%s", table, row.Label)
+			}
+		}
+	}
+	l.tables[table] = append(l.tables[table], rows...)
+	return nil
+}
+
+// add adds rows of `doc`, labeled rows in the order of `labels`
+func (l *Loader) add(doc map[string]interface{}, labels map[string][]string) error {
+	for _, table := range sorted.Keys(doc) {
+		var rows []*Row
+		switch tp := doc[table].(type) {
+		case []interface{}:
+			for _, fields := range tp {
+				row, err := newRow(table, "", fields)
+				if err != nil {
+					return err
+				}
+				rows = append(rows, row)
+			}
+		case map[string]interface{}:
+			order := labels[table]
+			if len(order) != len(tp) {
+				order = sorted.Keys(tp)
+			}
+			for _, label := range order {
+				row, err := newRow(table, label, tp[label])
+				if err != nil {
+					return err
+				}
+				rows = append(rows, row)
+			}
+		case nil:
+		default:
+			return fmt.Errorf("rows of %s are neither labeled nor listed", table)
+		}
+		if err := l.Add(table, rows...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newRow(table string, label string, fields interface{}) (*Row, error) {
+	m, ok := fields.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("row %s.%s is no map", table, label)
+	}
+	row := &Row{Label:label, Fields:dbutils.FieldMap{}}
+	for name, value := range m {
+		value, err := fieldValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s.%s: %v", table, label, name, err)
+		}
+		row.Fields[name] = value
+	}
+	return row, nil
+}
+
+// fieldValue converts a decoded value to a field value or a `ref`
+func fieldValue(value interface{}) (interface{}, error) {
+	switch tp := value.(type) {
+	case string:
+		if strings.HasPrefix(tp, "$$") {
+			return tp[1:], nil
+		}
+		if strings.HasPrefix(tp, "$") {
+			parts := strings.SplitN(tp[1:], ".", 2)
+			if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				return nil, fmt.Errorf("bad reference %s", tp)
+			}
+			return ref{table:parts[0], label:parts[1]}, nil
+		}
+		return tp, nil
+	case json.Number:
+		if i, err := tp.Int64(); err == nil {
+			return i, nil
+		}
+		return tp.Float64()
+	case map[string]interface{}, []interface{}:
+		data, err := json.Marshal(tp)
+		return string(data), err
+	default:
+		return tp, nil
+	}
+}
+
+// order returns tables in the order of references
+func (l *Loader) order() ([]string, error) {
+	deps := map[string][]string{}
+	for table, rows := range l.tables {
+		for _, row := range rows {
+			for _, value := range row.Fields {
+				r, ok := value.(ref)
+				if !ok {
+					continue
+				}
+				if _, ok := l.tables[r.table]; !ok {
+					return nil, fmt.Errorf("%s.%s refers to unknown table %s", table, row.Label, r)
+				}
+				if r.table == table {
+					// rows above are inserted first
+					continue
+				}
+				deps[table] = append(deps[table], r.table)
+			}
+		}
+	}
+	var order []string
+	const visiting, visited = 1, 2
+	state := map[string]int{}
+	var visit func(table string) error
+	visit = func(table string) error {
+		switch state[table] {
+		case visiting:
+			return fmt.Errorf("cyclic references of table %s", table)
+		case visited:
+			return nil
+		}
+		state[table] = visiting
+		dependencies := deps[table]
+		sort.Strings(dependencies)
+		for _, dep := range dependencies {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		state[table] = visited
+		order = append(order, table)
+		return nil
+	}
+	for _, table := range sorted.Keys(l.tables) {
+		if err := visit(table); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// referred returns labels of rows referred to by table
+func (l *Loader) referred() map[string]map[string]bool {
+	referred := map[string]map[string]bool{}
+	for _, rows := range l.tables {
+		for _, row := range rows {
+			for _, value := range row.Fields {
+				if r, ok := value.(ref); ok {
+					if referred[r.table] == nil {
+						referred[r.table] = map[string]bool{}
+					}
+					referred[r.table][r.label] = true
+				}
+			}
+		}
+	}
+	return referred
+}
+
+// Load inserts all rows by tables of `tx` and returns ids of labeled rows
+func (l *Loader) Load(tx *sqlx.Tx) (ids IDs, err error) {
+	order, err := l.order()
+	if err != nil {
+		return nil, err
+	}
+	if l.opts.Truncate {
+		// delete referring rows first
+		for i := len(order) - 1; i >= 0; i-- {
+			if _, err = dbutils.NewSimpleTable(tx, order[i]).Delete(); err != nil {
+				return nil, fmt.Errorf("truncate %s: %v", order[i], err)
+			}
+		}
+	}
+	ids = IDs{}
+	referred := l.referred()
+	for _, name := range order {
+		if err = l.load(tx, dbutils.NewSimpleTable(tx, name), name, referred[name], ids); err != nil {
+			return nil, fmt.Errorf("load %s: %v", name, err)
+		}
+	}
+	return ids, nil
+}
+
+// load inserts rows of `table`
+func (l *Loader) load(tx *sqlx.Tx, table *dbutils.SimpleTable, name string, referred map[string]bool, ids IDs) error {
+	// consecutive rows of the same columns are inserted together,
+	// rows of a table referring to itself are inserted one by one in order
+	var batch dbutils.FieldValuesMap
+	var batchColumns string
+	flush := func() error {
+		if batch != nil {
+			if _, err := table.InsertMany(batch); err != nil {
+				return err
+			}
+		}
+		batch, batchColumns = nil, ""
+		return nil
+	}
+	selfReferring := l.refersTo(name, name)
+	for _, row := range l.tables[name] {
+		fields, err := resolve(row.Fields, ids)
+		if err != nil {
+			if r, ok := err.(unknownRow); ok && r.table == name {
+				return fmt.Errorf("%s.%s refers to %s below it", name, row.Label, r.ref)
+			}
+			return err
+		}
+		if id, ok := fields["id"]; ok && row.Label != "" {
+			ids[name + "." + row.Label] = id
+		}
+		if _, ok := ids[name + "." + row.Label]; !ok && referred[row.Label] {
+			if err = flush(); err != nil {
+				return err
+			}
+			id, err := insert(tx, table, name, fields)
+			if err != nil {
+				return err
+			}
+			ids[name + "." + row.Label] = id
+			continue
+		}
+		if columns := strings.Join(sorted.Keys(fields), ","); columns != batchColumns {
+			if err = flush(); err != nil {
+				return err
+			}
+			batch, batchColumns = dbutils.FieldValuesMap{}, columns
+		}
+		for field, value := range fields {
+			batch[field] = append(batch[field], value)
+		}
+		if selfReferring {
+			if err = flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return flush()
+}
+
+// insert inserts a row of `table` named `name` and returns its id,
+// Postgres has no `LastInsertId` so the statement returning the id runs on `tx`
+func insert(tx *sqlx.Tx, table *dbutils.SimpleTable, name string, fields dbutils.FieldMap) (interface{}, error) {
+	if table.Dialect() != Q.Postgres {
+		return table.Insert(fields)
+	}
+	query, args, err := dbutils.BuildInsertSQL(name, fields)
+	if err != nil {
+		return nil, err
+	}
+	var id int64
+	err = tx.QueryRowx(tx.Rebind(query + " RETURNING id"), args...).Scan(&id)
+	return id, err
+}
+
+// refersTo tells if rows of `table` refer to rows of `other`
+func (l *Loader) refersTo(table string, other string) bool {
+	for _, row := range l.tables[table] {
+		for _, value := range row.Fields {
+			if r, ok := value.(ref); ok && r.table == other {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// resolve returns a copy of `fields` with references replaced by ids
+func resolve(fields dbutils.FieldMap, ids IDs) (dbutils.FieldMap, error) {
+	resolved := dbutils.FieldMap{}
+	for name, value := range fields {
+		if r, ok := value.(ref); ok {
+			id, ok := ids[r.table + "." + r.label]
+			if !ok {
+				return nil, unknownRow{r}
+			}
+			value = id
+		}
+		resolved[name] = value
+	}
+	return resolved, nil
+}
+
+// unknownRow is the error of a reference to a row not inserted
+type unknownRow struct {
+	ref
+}
+
+func (e unknownRow) Error() string {
+	return "unknown row " + e.ref.String()
+}
@@ -0,0 +1,213 @@
+package fixtures
+
+import (
+	"database/sql/driver"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/argpass/dbutils/Q"
+	"github.com/argpass/dbutils/dbtest"
+	"github.com/argpass/dbutils/internal/fakedb"
+	"github.com/jmoiron/sqlx"
+)
+
+var schema = dbtest.Schema{
+	Create: map[Q.Dialect]string{
+		Q.SQLite: `CREATE TABLE authors(id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL);
+		CREATE TABLE books(id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL,
+			author_id INTEGER NOT NULL REFERENCES authors(id), meta TEXT)`,
+	},
+}
+
+const authors = `
+authors:
+  alice:
+    name: Alice
+  bob:
+    id: 10
+    name: Bob
+  carol:
+    name: $$carol
+`
+
+const books = `{
+  "books": [
+    {"name": "Go", "author_id": "$authors.alice", "meta": {"pages": 300}},
+    {"name": "Rust", "author_id": "$authors.bob"}
+  ]
+}`
+
+func TestLoader_Load(t *testing.T) {
+	dbtest.Run(t, schema, func(t *testing.T, tx *sqlx.Tx) {
+		tx.MustExec("INSERT INTO authors (name) VALUES ('old')")
+		dir := t.TempDir()
+		os.WriteFile(filepath.Join(dir, "authors.yml"), []byte(authors), 0644)
+		os.WriteFile(filepath.Join(dir, "books.json"), []byte(books), 0644)
+
+		loader := New(Options{Truncate:true})
+		if err := loader.AddFiles(filepath.Join(dir, "books.json"), filepath.Join(dir, "authors.yml")); err != nil {
+			t.Fatalf("err:%v", err)
+		}
+		ids, err := loader.Load(tx)
+		if err != nil {
+			t.Fatalf("err:%v", err)
+		}
+		var names []string
+		tx.Select(&names, "SELECT name FROM authors ORDER BY name")
+		if len(names) != 3 || names[0] != "$carol" {
+			t.Fatalf("bad authors:%v", names)
+		}
+		var meta string
+		var authorID int64
+		tx.QueryRowx("SELECT author_id, meta FROM books WHERE name = 'Go'").Scan(&authorID, &meta)
+		if authorID != ids.ID("authors", "alice") || meta != `{"pages":300}` {
+			t.Fatalf("bad book %d %s, ids:%v", authorID, meta, ids)
+		}
+		tx.QueryRowx("SELECT author_id FROM books WHERE name = 'Rust'").Scan(&authorID)
+		if authorID != 10 {
+			t.Fatalf("expect author 10, got %d", authorID)
+		}
+	})
+}
+
+func TestLoader_FileOrder(t *testing.T) {
+	dbtest.Run(t, treeSchema, func(t *testing.T, tx *sqlx.Tx) {
+		// rows of other columns between rows of the same columns
+		yml := `
+nodes:
+  - name: a
+  - name: b
+    parent_id: 1
+  - name: c
+`
+		loader := New(Options{})
+		if err := loader.AddYAML([]byte(yml)); err != nil {
+			t.Fatalf("err:%v", err)
+		}
+		if _, err := loader.Load(tx); err != nil {
+			t.Fatalf("err:%v", err)
+		}
+		var names []string
+		tx.Select(&names, "SELECT name FROM nodes ORDER BY id")
+		if strings.Join(names, ",") != "a,b,c" {
+			t.Fatalf("expect rows in file order, got %v", names)
+		}
+	})
+}
+
+func TestLoader_Cycle(t *testing.T) {
+	loader := New(Options{})
+	err := loader.AddYAML([]byte(`
+a: {x: {b_id: $b.y}}
+b: {y: {a_id: $a.x}}
+`))
+	if err != nil {
+		t.Fatalf("err:%v", err)
+	}
+	if _, err = loader.order(); err == nil {
+		t.Fatalf("expect cyclic references")
+	}
+}
+
+var treeSchema = dbtest.Schema{
+	Create: map[Q.Dialect]string{
+		Q.SQLite: `CREATE TABLE nodes(id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL,
+			parent_id INTEGER NULL REFERENCES nodes(id))`,
+	},
+}
+
+func TestLoader_SelfReference(t *testing.T) {
+	dbtest.Run(t, treeSchema, func(t *testing.T, tx *sqlx.Tx) {
+		// labels are out of alphabetical order, rows refer to rows above them
+		yml := `
+nodes:
+  root:
+    name: root
+  leaf:
+    name: leaf
+    parent_id: $nodes.branch
+  branch:
+    name: branch
+    parent_id: $nodes.root
+`
+		loader := New(Options{})
+		if err := loader.AddYAML([]byte(yml)); err != nil {
+			t.Fatalf("err:%v", err)
+		}
+		if _, err := loader.Load(tx); err == nil || !strings.Contains(err.Error(), "below") {
+			t.Fatalf("expect error of referring to a row below, got %v", err)
+		}
+
+		for _, doc := range []struct{ json bool; data string }{
+			{false, `
+nodes:
+  root:
+    name: root
+  branch:
+    name: branch
+    parent_id: $nodes.root
+  leaf:
+    name: leaf
+    parent_id: $nodes.branch
+`},
+			{true, `{"nodes": {"root": {"name": "root"}, "branch": {"name": "branch", "parent_id": "$nodes.root"},
+				"leaf": {"name": "leaf", "parent_id": "$nodes.branch"}}}`},
+		} {
+			tx.MustExec("DELETE FROM nodes")
+			loader := New(Options{})
+			var err error
+			if doc.json {
+				err = loader.AddJSON([]byte(doc.data))
+			}else {
+				err = loader.AddYAML([]byte(doc.data))
+			}
+			if err != nil {
+				t.Fatalf("err:%v", err)
+			}
+			ids, err := loader.Load(tx)
+			if err != nil {
+				t.Fatalf("err:%v", err)
+			}
+			var parentID int64
+			tx.QueryRowx("SELECT parent_id FROM nodes WHERE name = 'leaf'").Scan(&parentID)
+			if parentID != ids.ID("nodes", "branch") {
+				t.Fatalf("expect parent %v, got %d", ids.ID("nodes", "branch"), parentID)
+			}
+			tx.QueryRowx("SELECT parent_id FROM nodes WHERE name = 'branch'").Scan(&parentID)
+			if parentID != ids.ID("nodes", "root") {
+				t.Fatalf("expect parent %v, got %d", ids.ID("nodes", "root"), parentID)
+			}
+		}
+	})
+}
+
+func TestLoader_PostgresID(t *testing.T) {
+	var queries []string
+	db := fakedb.Open("postgres", func(query string, args []driver.Value) (*fakedb.Answer, error) {
+		queries = append(queries, query)
+		if strings.HasSuffix(query, "RETURNING id") {
+			return &fakedb.Answer{Columns:[]string{"id"}, Rows:[][]driver.Value{{int64(7)}}}, nil
+		}
+		return &fakedb.Answer{RowsAffected:1}, nil
+	})
+	tx, err := db.Beginx()
+	if err != nil {
+		t.Fatalf("err:%v", err)
+	}
+	loader := New(Options{})
+	if err = loader.AddYAML([]byte(authors)); err != nil {
+		t.Fatalf("err:%v", err)
+	}
+	if err = loader.AddJSON([]byte(books)); err != nil {
+		t.Fatalf("err:%v", err)
+	}
+	ids, err := loader.Load(tx)
+	if err != nil {
+		t.Fatalf("err:%v, queries:%v", err, queries)
+	}
+	if ids.ID("authors", "alice") != int64(7) {
+		t.Fatalf("expect id 7 of alice, got %v, queries:%v", ids.ID("authors", "alice"), queries)
+	}
+}
@@ -0,0 +1,110 @@
+package dbutils
+
+import (
+	"errors"
+	"strings"
+	"sync"
+)
+
+// READ_ONLY is the error returned by the `ReadOnly` hook for writing statements
+var READ_ONLY = errors.New("read only mode")
+
+// Statement is a sql statement about to be executed by `SimpleTable`
+// hooks can rewrite `Query` and `Args`,
+// args of sensitive columns are `SensitiveArg` values in `Args`
+type Statement struct {
+	Query  string
+	Args   []interface{}
+	Table  string
+	Op     Op
+	Method string
+	// TxID is the id of the `Tx` running the statement, 0 if not in a `Tx`
+	TxID   uint64
+	// CaptureRows makes the table capture rows returned by a select
+	// in `Columns` and `Values` of its `RowsEvent`
+	CaptureRows bool
+	// CaptureCaller makes the table capture the call stack running the statement
+	// in `SQLEvent.Caller`
+	CaptureCaller bool
+}
+
+// Hook runs around a statement like a middleware,
+// it calls `next` to go on (and finally execute the statement)
+// or returns an error to abort it
+//
+// Example:
+//   // reject statements on other tenants
+//   dbutils.Before(func(stmt *Statement, next func(*Statement) error) error {
+//       if !strings.Contains(stmt.Query, "tenant_id") {
+//           return errors.New("no tenant")
+//       }
+//       return next(stmt)
+//   })
+type Hook func(stmt *Statement, next func(*Statement) error) error
+
+type hookChain struct {
+	sync.RWMutex
+	hooks []Hook
+}
+
+var globalHooks = &hookChain{}
+
+// Before adds hooks running around statements of every `SimpleTable`
+// global hooks run before hooks of the table
+func Before(hooks ...Hook) {
+	globalHooks.Lock()
+	defer globalHooks.Unlock()
+	globalHooks.hooks = append(globalHooks.hooks, hooks...)
+}
+
+// ResetHooks removes all global hooks
+func ResetHooks() {
+	globalHooks.Lock()
+	defer globalHooks.Unlock()
+	globalHooks.hooks = nil
+}
+
+// all returns global hooks followed by `hooks`
+func (c *hookChain) all(hooks []Hook) []Hook {
+	c.RLock()
+	defer c.RUnlock()
+	if len(c.hooks) == 0 {
+		return hooks
+	}
+	all := make([]Hook, 0, len(c.hooks) + len(hooks))
+	all = append(all, c.hooks...)
+	return append(all, hooks...)
+}
+
+// runHooks calls `hooks` in order and `fn` at the end of the chain
+func runHooks(hooks []Hook, stmt *Statement, fn func(*Statement) error) error {
+	var call func(i int, stmt *Statement) error
+	call = func(i int, stmt *Statement) error {
+		if i == len(hooks) {
+			return fn(stmt)
+		}
+		return hooks[i](stmt, func(stmt *Statement) error {
+			return call(i + 1, stmt)
+		})
+	}
+	return call(0, stmt)
+}
+
+// ReadOnly is a hook rejecting all statements but selects with `READ_ONLY`
+func ReadOnly() Hook {
+	return func(stmt *Statement, next func(*Statement) error) error {
+		if stmt.Op != OpSelect {
+			return READ_ONLY
+		}
+		return next(stmt)
+	}
+}
+
+// Comment is a hook tagging statements with the comment `/* text */`
+func Comment(text string) Hook {
+	text = strings.Replace(text, "*/", "* /", -1)
+	return func(stmt *Statement, next func(*Statement) error) error {
+		stmt.Query = "/* " + text + " */ " + stmt.Query
+		return next(stmt)
+	}
+}
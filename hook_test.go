@@ -0,0 +1,43 @@
+package dbutils
+
+import (
+	"testing"
+)
+
+func TestRunHooks(t *testing.T) {
+	var executed *Statement
+	hooks := []Hook{Comment("service=books */"), func(stmt *Statement, next func(*Statement) error) error {
+		stmt.Args = append(stmt.Args, 42)
+		return next(stmt)
+	}}
+	stmt := &Statement{Query:"SELECT * FROM t_book WHERE tenant = ?", Op:OpSelect}
+	err := runHooks(hooks, stmt, func(stmt *Statement) error {
+		executed = stmt
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("err:%v", err)
+	}
+	if executed.Query != "/* service=books * / */ SELECT * FROM t_book WHERE tenant = ?" {
+		t.Fatalf("bad query:%s", executed.Query)
+	}
+	if len(executed.Args) != 1 || executed.Args[0] != 42 {
+		t.Fatalf("args is wrong:%v", executed.Args)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	executed := false
+	fn := func(stmt *Statement) error {
+		executed = true
+		return nil
+	}
+	err := runHooks([]Hook{ReadOnly()}, &Statement{Query:"DELETE FROM t_book", Op:OpDelete}, fn)
+	if err != READ_ONLY || executed {
+		t.Fatalf("expect READ_ONLY, got %v", err)
+	}
+	err = runHooks([]Hook{ReadOnly()}, &Statement{Query:"SELECT * FROM t_book", Op:OpSelect}, fn)
+	if err != nil || !executed {
+		t.Fatalf("expect select executed, got %v", err)
+	}
+}
@@ -0,0 +1,166 @@
+// Package fakedb is a fake `database/sql` driver answering statements by a callback,
+// the mock and the replayer of `dbutils` run their databases on it
+package fakedb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Answer is what a statement returns,
+// `Columns` and `Rows` are the rows of a query
+type Answer struct {
+	LastInsertID int64
+	RowsAffected int64
+	Columns      []string
+	Rows         [][]driver.Value
+}
+
+// Handler answers the statement `query` with `args`,
+// it is called for both exec and query
+type Handler func(query string, args []driver.Value) (*Answer, error)
+
+// Open returns a database answering statements by `handler`,
+// `driverName` picks the dialect of tables.
+// Transactions do nothing, statements of them are answered at once
+func Open(driverName string, handler Handler) *sqlx.DB {
+	return sqlx.NewDb(sql.OpenDB(connector{handler}), driverName)
+}
+
+type connector struct {
+	handler Handler
+}
+
+func (c connector) Connect(ctx context.Context) (driver.Conn, error) {
+	return &conn{handler:c.handler}, nil
+}
+
+func (c connector) Driver() driver.Driver {
+	return fakeDriver{c.handler}
+}
+
+type fakeDriver struct {
+	handler Handler
+}
+
+func (d fakeDriver) Open(name string) (driver.Conn, error) {
+	return &conn{handler:d.handler}, nil
+}
+
+type conn struct {
+	handler Handler
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return &stmt{conn:c, query:query}, nil
+}
+
+func (c *conn) Close() error {
+	return nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return tx{}, nil
+}
+
+func (c *conn) answer(query string, args []driver.NamedValue) (*Answer, error) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	return c.handler(query, values)
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	answer, err := c.answer(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return result{answer}, nil
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	answer, err := c.answer(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &rows{answer:answer}, nil
+}
+
+// tx is a transaction doing nothing
+type tx struct{}
+
+func (tx) Commit() error {
+	return nil
+}
+
+func (tx) Rollback() error {
+	return nil
+}
+
+type stmt struct {
+	conn  *conn
+	query string
+}
+
+func (s *stmt) Close() error {
+	return nil
+}
+
+func (s *stmt) NumInput() int {
+	return -1
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.conn.ExecContext(context.Background(), s.query, named(args))
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.conn.QueryContext(context.Background(), s.query, named(args))
+}
+
+func named(args []driver.Value) []driver.NamedValue {
+	values := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		values[i] = driver.NamedValue{Ordinal:i + 1, Value:arg}
+	}
+	return values
+}
+
+type result struct {
+	answer *Answer
+}
+
+func (r result) LastInsertId() (int64, error) {
+	return r.answer.LastInsertID, nil
+}
+
+func (r result) RowsAffected() (int64, error) {
+	return r.answer.RowsAffected, nil
+}
+
+type rows struct {
+	answer *Answer
+	next   int
+}
+
+func (r *rows) Columns() []string {
+	return r.answer.Columns
+}
+
+func (r *rows) Close() error {
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.next >= len(r.answer.Rows) {
+		return io.EOF
+	}
+	copy(dest, r.answer.Rows[r.next])
+	r.next++
+	return nil
+}
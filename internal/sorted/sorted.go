@@ -0,0 +1,17 @@
+// Package sorted walks maps in the order of keys,
+// builders and loaders of `dbutils` use it so the same input always gives the same SQL
+package sorted
+
+import (
+	"sort"
+)
+
+// Keys returns keys of `m` in order
+func Keys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
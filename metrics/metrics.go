@@ -0,0 +1,243 @@
+// Package metrics aggregates sql events of `dbutils` and serves them
+// in the Prometheus text exposition format
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/argpass/dbutils"
+	"github.com/argpass/dbutils/evt"
+)
+
+// DefaultBuckets are the upper bounds (in seconds) of the duration histogram
+var DefaultBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Options configures a `Collector`
+type Options struct {
+	// Namespace prefixes metric names, "dbutils" by default
+	Namespace  string
+	// Buckets of the duration histogram, `DefaultBuckets` by default,
+	// they are sorted and duplicates, NaN and +Inf are dropped
+	Buckets    []float64
+	// ErrorClass labels the error of a statement, `ErrorClass` by default
+	ErrorClass func(err error) string
+}
+
+type key struct {
+	table string
+	op    string
+	class string
+}
+
+type series struct {
+	count   uint64
+	rows    int64
+	sum     float64
+	buckets []uint64
+}
+
+// Collector aggregates `dbutils.SQLEvent`s to counters and histograms
+// labelled by table, op and error class, it serves them as an `http.Handler`
+//
+// Example:
+//   collector := metrics.New(metrics.Options{})
+//   collector.Subscribe(nil)
+//   http.Handle("/metrics", collector)
+type Collector struct {
+	opts   Options
+	lock   sync.Mutex
+	series map[key]*series
+}
+
+var _ http.Handler = &Collector{}
+
+// New creates a `Collector`
+func New(opts Options) *Collector {
+	if opts.Namespace == "" {
+		opts.Namespace = "dbutils"
+	}
+	if len(opts.Buckets) == 0 {
+		opts.Buckets = DefaultBuckets
+	}
+	opts.Buckets = normalize(opts.Buckets)
+	if opts.ErrorClass == nil {
+		opts.ErrorClass = ErrorClass
+	}
+	return &Collector{opts:opts, series:map[key]*series{}}
+}
+
+// normalize returns sorted distinct finite bounds of `buckets`,
+// +Inf is the implicit last bucket
+func normalize(buckets []float64) []float64 {
+	var bounds []float64
+	for _, bound := range buckets {
+		if !math.IsNaN(bound) && !math.IsInf(bound, 1) {
+			bounds = append(bounds, bound)
+		}
+	}
+	sort.Float64s(bounds)
+	distinct := bounds[:0]
+	for i, bound := range bounds {
+		if i == 0 || bound != bounds[i-1] {
+			distinct = append(distinct, bound)
+		}
+	}
+	return distinct
+}
+
+// ErrorClass is the default classifier of statement errors,
+// wrapped errors are classed by the errors they wrap
+func ErrorClass(err error) string {
+	switch {
+	case err == nil:
+		return "none"
+	case errors.Is(err, sql.ErrNoRows):
+		return "no_rows"
+	case errors.Is(err, sql.ErrTxDone):
+		return "tx_done"
+	case errors.Is(err, sql.ErrConnDone), errors.Is(err, driver.ErrBadConn):
+		return "bad_conn"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, dbutils.READ_ONLY):
+		return "read_only"
+	}
+	return "error"
+}
+
+// Subscribe connects the collector with sql and rows events of `bus` (the default bus if nil)
+func (c *Collector) Subscribe(bus *evt.Bus) *evt.Subscription {
+	if bus == nil {
+		bus = evt.Default()
+	}
+	return bus.SubscribeAll(func(e evt.Event) (result interface{}) {
+		switch ev := e.(type) {
+		case *dbutils.SQLEvent:
+			c.Observe(ev)
+		case *dbutils.RowsEvent:
+			c.ObserveRows(ev)
+		}
+		return nil
+	})
+}
+
+// Observe adds the event to metrics
+func (c *Collector) Observe(ev *dbutils.SQLEvent) {
+	seconds := ev.Duration.Seconds()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	s := c.seriesOf(ev)
+	s.count++
+	s.sum += seconds
+	if ev.Rows > 0 {
+		s.rows += ev.Rows
+	}
+	for i, bound := range c.opts.Buckets {
+		if seconds <= bound {
+			s.buckets[i]++
+		}
+	}
+}
+
+// ObserveRows adds rows returned by a select to metrics
+func (c *Collector) ObserveRows(ev *dbutils.RowsEvent) {
+	if ev.Event.Rows <= 0 {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.seriesOf(ev.Event).rows += ev.Event.Rows
+}
+
+// seriesOf returns the series of the event, it must be called with the lock held
+func (c *Collector) seriesOf(ev *dbutils.SQLEvent) *series {
+	k := key{table:ev.Table, op:string(ev.Op), class:c.opts.ErrorClass(ev.Error)}
+	s, ok := c.series[k]
+	if !ok {
+		s = &series{buckets:make([]uint64, len(c.opts.Buckets))}
+		c.series[k] = s
+	}
+	return s
+}
+
+// ServeHTTP writes metrics in the Prometheus text exposition format
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.Write(w)
+}
+
+// Write writes metrics in the Prometheus text exposition format
+func (c *Collector) Write(w io.Writer) error {
+	c.lock.Lock()
+	keys := make([]key, 0, len(c.series))
+	snapshot := make(map[key]series, len(c.series))
+	for k, s := range c.series {
+		keys = append(keys, k)
+		copied := *s
+		copied.buckets = append([]uint64(nil), s.buckets...)
+		snapshot[k] = copied
+	}
+	c.lock.Unlock()
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.table != b.table {
+			return a.table < b.table
+		}
+		if a.op != b.op {
+			return a.op < b.op
+		}
+		return a.class < b.class
+	})
+
+	bw := bufio.NewWriter(w)
+	ns := c.opts.Namespace
+	name := ns + "_sql_statements_total"
+	fmt.Fprintf(bw, "# HELP %s Number of sql statements.\n# TYPE %s counter\n", name, name)
+	for _, k := range keys {
+		fmt.Fprintf(bw, "%s{%s} %d\n", name, labels(k), snapshot[k].count)
+	}
+	name = ns + "_sql_rows_total"
+	fmt.Fprintf(bw, "# HELP %s Number of rows affected or returned by sql statements.\n# TYPE %s counter\n", name, name)
+	for _, k := range keys {
+		fmt.Fprintf(bw, "%s{%s} %d\n", name, labels(k), snapshot[k].rows)
+	}
+	name = ns + "_sql_duration_seconds"
+	fmt.Fprintf(bw, "# HELP %s Duration of sql statements.\n# TYPE %s histogram\n", name, name)
+	for _, k := range keys {
+		s := snapshot[k]
+		l := labels(k)
+		for i, bound := range c.opts.Buckets {
+			fmt.Fprintf(bw, "%s_bucket{%s,le=\"%s\"} %d\n", name, l, formatFloat(bound), s.buckets[i])
+		}
+		fmt.Fprintf(bw, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, l, s.count)
+		fmt.Fprintf(bw, "%s_sum{%s} %s\n", name, l, formatFloat(s.sum))
+		fmt.Fprintf(bw, "%s_count{%s} %d\n", name, l, s.count)
+	}
+	return bw.Flush()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func labels(k key) string {
+	return fmt.Sprintf(`table="%s",op="%s",error="%s"`,
+		labelEscaper.Replace(k.table), labelEscaper.Replace(k.op), labelEscaper.Replace(k.class))
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/argpass/dbutils"
+	"github.com/argpass/dbutils/evt"
+)
+
+func TestCollector(t *testing.T) {
+	bus := evt.NewBus()
+	c := New(Options{Buckets:[]float64{0.01, 0.1}})
+	c.Subscribe(bus)
+	bus.Send(&dbutils.SQLEvent{Table:"t_book", Op:dbutils.OpSelect, Rows:3, Duration:5 * time.Millisecond})
+	bus.Send(&dbutils.SQLEvent{Table:"t_book", Op:dbutils.OpSelect, RowsPending:true, Duration:50 * time.Millisecond})
+	bus.Send(&dbutils.RowsEvent{Event:&dbutils.SQLEvent{Table:"t_book", Op:dbutils.OpSelect, Rows:1}})
+	bus.Send(&dbutils.SQLEvent{Table:"t_book", Op:dbutils.OpInsert, Error:errors.New("dup"), Duration:time.Second})
+
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	t.Log(body)
+	for _, line := range []string{
+		`dbutils_sql_statements_total{table="t_book",op="select",error="none"} 2`,
+		`dbutils_sql_statements_total{table="t_book",op="insert",error="error"} 1`,
+		`dbutils_sql_rows_total{table="t_book",op="select",error="none"} 4`,
+		`dbutils_sql_duration_seconds_bucket{table="t_book",op="select",error="none",le="0.01"} 1`,
+		`dbutils_sql_duration_seconds_bucket{table="t_book",op="select",error="none",le="0.1"} 2`,
+		`dbutils_sql_duration_seconds_bucket{table="t_book",op="insert",error="error",le="+Inf"} 1`,
+		`dbutils_sql_duration_seconds_count{table="t_book",op="select",error="none"} 2`,
+	} {
+		if !strings.Contains(body, line + "\n") {
+			t.Fatalf("expect line %s", line)
+		}
+	}
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatalf("bad content type %s", rec.Header().Get("Content-Type"))
+	}
+}
+
+func TestNew_Buckets(t *testing.T) {
+	buckets := []float64{0.1, 0.01, 0.1, math.Inf(1)}
+	c := New(Options{Buckets:buckets})
+	if fmt.Sprint(c.opts.Buckets) != "[0.01 0.1]" {
+		t.Fatalf("expect sorted distinct buckets, got %v", c.opts.Buckets)
+	}
+	if buckets[0] != 0.1 {
+		t.Fatalf("expect buckets of options untouched, got %v", buckets)
+	}
+}
+
+func TestErrorClass_Wrapped(t *testing.T) {
+	classes := map[error]string{
+		nil:"none",
+		fmt.Errorf("query: %w", context.DeadlineExceeded):"timeout",
+		fmt.Errorf("hook: %w", dbutils.READ_ONLY):"read_only",
+		fmt.Errorf("get: %w", sql.ErrNoRows):"no_rows",
+		errors.New("dup"):"error",
+	}
+	for err, class := range classes {
+		if actual := ErrorClass(err); actual != class {
+			t.Fatalf("expect %s of %v, got %s", class, err, actual)
+		}
+	}
+}
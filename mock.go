@@ -0,0 +1,282 @@
+package dbutils
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sync"
+	"github.com/argpass/dbutils/Q"
+	"github.com/argpass/dbutils/internal/fakedb"
+	"github.com/argpass/dbutils/internal/sorted"
+	"github.com/jmoiron/sqlx"
+)
+
+// ArgMatcher matches an arg of an expected statement,
+// the arg is converted to a driver value (ints are int64 etc)
+type ArgMatcher interface {
+	MatchArg(arg driver.Value) bool
+}
+
+type anyArg struct{}
+
+func (anyArg) MatchArg(arg driver.Value) bool {
+	return true
+}
+
+// AnyArg matches any arg
+func AnyArg() ArgMatcher {
+	return anyArg{}
+}
+
+// Expectation is a statement expected by `Mock`
+// and what it returns
+type Expectation struct {
+	desc         string
+	match        func(query string) bool
+	args         []interface{}
+	checkArgs    bool
+	columns      []string
+	rows         [][]driver.Value
+	lastInsertID int64
+	rowsAffected int64
+	err          error
+	// invalid is the error of setting up the expectation,
+	// the matching statement and `Mock.ExpectationsWereMet` return it
+	invalid      error
+	met          bool
+}
+
+// WithArgs expects the statement with `args`,
+// an `ArgMatcher` arg matches the arg by itself.
+// Args are not checked if it is never called
+func (e *Expectation) WithArgs(args ...interface{}) *Expectation {
+	e.args = args
+	e.checkArgs = true
+	return e
+}
+
+// ReturnResult makes the statement return the result of `Exec`
+func (e *Expectation) ReturnResult(lastInsertID int64, rowsAffected int64) *Expectation {
+	e.lastInsertID = lastInsertID
+	e.rowsAffected = rowsAffected
+	return e
+}
+
+// ReturnRows makes the statement return rows of `columns`,
+// a value no driver value converts from makes the expectation invalid
+func (e *Expectation) ReturnRows(columns []string, rows ...[]interface{}) *Expectation {
+	e.columns = columns
+	for _, row := range rows {
+		values := make([]driver.Value, len(row))
+		for i, v := range row {
+			value, err := driver.DefaultParameterConverter.ConvertValue(v)
+			if err != nil {
+				if e.invalid == nil {
+					e.invalid = fmt.Errorf("mock: bad value %v of %s: %v", v, e.desc, err)
+				}
+				continue
+			}
+			values[i] = value
+		}
+		e.rows = append(e.rows, values)
+	}
+	e.rowsAffected = int64(len(e.rows))
+	return e
+}
+
+// ReturnResults makes the statement return rows of `results`,
+// columns are the sorted names of all results
+func (e *Expectation) ReturnResults(results ...Result) *Expectation {
+	var all = Result{}
+	for _, result := range results {
+		for name, value := range result {
+			all[name] = value
+		}
+	}
+	columns := sorted.Keys(all)
+	var rows [][]interface{}
+	for _, result := range results {
+		row := make([]interface{}, len(columns))
+		for i, name := range columns {
+			row[i] = result[name]
+		}
+		rows = append(rows, row)
+	}
+	return e.ReturnRows(columns, rows...)
+}
+
+// ReturnError makes the statement fail with `err`
+func (e *Expectation) ReturnError(err error) *Expectation {
+	e.err = err
+	return e
+}
+
+// matches tells if the statement is expected
+func (e *Expectation) matches(query string, args []driver.Value) bool {
+	if !e.match(query) {
+		return false
+	}
+	if !e.checkArgs {
+		return true
+	}
+	if len(e.args) != len(args) {
+		return false
+	}
+	for i, expected := range e.args {
+		if matcher, ok := expected.(ArgMatcher); ok {
+			if !matcher.MatchArg(args[i]) {
+				return false
+			}
+			continue
+		}
+		value, err := driver.DefaultParameterConverter.ConvertValue(expected)
+		if err != nil || !reflect.DeepEqual(value, args[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *Expectation) String() string {
+	if e.checkArgs {
+		return fmt.Sprintf("%s with args %v", e.desc, e.args)
+	}
+	return e.desc
+}
+
+// Mock is a fake database answering statements with expectations,
+// tables of its transactions run without a database.
+// Expectations are matched in order unless `Unordered` is called,
+// an expectation is met once.
+//
+// Example:
+//   mock := dbutils.NewMock("mysql")
+//   mock.Expect("INSERT INTO t_book (name) VALUES (?)").WithArgs("golang").ReturnResult(1, 1)
+//   mock.ExpectRegexp(`^SELECT .* FROM t_book`).
+//       ReturnResults(dbutils.Result{"id": 1, "name": "golang"})
+//
+//   table := dbutils.NewSimpleTable(mock.Tx(), "t_book")
+//   ...
+//   if err := mock.ExpectationsWereMet(); err != nil {
+//       t.Fatal(err)
+//   }
+type Mock struct {
+	lock         sync.Mutex
+	db           *sqlx.DB
+	expectations []*Expectation
+	unordered    bool
+	// unexpected are errors of statements no expectation matches
+	unexpected   []error
+}
+
+// NewMock creates a `Mock`, `driverName` picks the dialect of tables
+func NewMock(driverName string) *Mock {
+	mock := &Mock{}
+	mock.db = fakedb.Open(driverName, mock.answer)
+	return mock
+}
+
+// DB returns the fake database
+func (m *Mock) DB() *sqlx.DB {
+	return m.db
+}
+
+// Tx begins a transaction of the fake database
+func (m *Mock) Tx() *sqlx.Tx {
+	return m.db.MustBegin()
+}
+
+// Unordered makes expectations matched in any order
+func (m *Mock) Unordered() *Mock {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.unordered = true
+	return m
+}
+
+func (m *Mock) expect(desc string, match func(query string) bool) *Expectation {
+	e := &Expectation{desc:desc, match:match}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.expectations = append(m.expectations, e)
+	return e
+}
+
+// Expect expects a statement of exactly `query`
+func (m *Mock) Expect(query string) *Expectation {
+	return m.expect(fmt.Sprintf("%q", query), func(actual string) bool {
+		return actual == query
+	})
+}
+
+// ExpectRegexp expects a statement matching regular expression `pattern`
+func (m *Mock) ExpectRegexp(pattern string) *Expectation {
+	re := regexp.MustCompile(pattern)
+	return m.expect(fmt.Sprintf("/%s/", pattern), re.MatchString)
+}
+
+// ExpectFingerprint expects a statement with the same `Fingerprint` as `query`
+func (m *Mock) ExpectFingerprint(query string) *Expectation {
+	dialect := Q.DialectOf(m.db.DriverName())
+	fingerprint := FingerprintFor(dialect, query)
+	return m.expect(fmt.Sprintf("fingerprint %q", fingerprint), func(actual string) bool {
+		return FingerprintFor(dialect, actual) == fingerprint
+	})
+}
+
+// ExpectationsWereMet returns an error if any statement is unexpected
+// or any expectation is not met
+func (m *Mock) ExpectationsWereMet() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if len(m.unexpected) > 0 {
+		return m.unexpected[0]
+	}
+	for _, e := range m.expectations {
+		if e.invalid != nil {
+			return e.invalid
+		}
+		if !e.met {
+			return fmt.Errorf("mock: expectation not met: %s", e)
+		}
+	}
+	return nil
+}
+
+// answer answers the statement by the expectation it matches
+func (m *Mock) answer(query string, values []driver.Value) (*fakedb.Answer, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	var next *Expectation
+	for _, e := range m.expectations {
+		if e.met {
+			continue
+		}
+		if next == nil {
+			next = e
+		}
+		if e.matches(query, values) {
+			e.met = true
+			if e.invalid != nil {
+				return nil, e.invalid
+			}
+			if e.err != nil {
+				return nil, e.err
+			}
+			return &fakedb.Answer{LastInsertID:e.lastInsertID, RowsAffected:e.rowsAffected,
+				Columns:e.columns, Rows:e.rows}, nil
+		}
+		if !m.unordered {
+			break
+		}
+	}
+	var err error
+	if next == nil {
+		err = fmt.Errorf("mock: unexpected statement %q with args %v", query, values)
+	}else {
+		err = fmt.Errorf("mock: unexpected statement %q with args %v, next is %s", query, values, next)
+	}
+	m.unexpected = append(m.unexpected, err)
+	return nil, err
+}
@@ -0,0 +1,86 @@
+package dbutils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/argpass/dbutils/Q"
+	"github.com/argpass/dbutils/evt"
+)
+
+func TestMock(t *testing.T) {
+	mock := NewMock("mysql")
+	mock.Expect("INSERT INTO t_book (name,price) VALUES (?,?)").WithArgs("golang", AnyArg()).ReturnResult(3, 1)
+	mock.ExpectFingerprint("SELECT * FROM t_book WHERE id IN (?) LIMIT 0, 1").WithArgs(1, 2).
+		ReturnResults(Result{"id":int64(1), "name":[]byte("golang")})
+	mock.ExpectRegexp(`^DELETE FROM t_book`).ReturnError(errors.New("locked"))
+
+	table := NewSimpleTable(mock.Tx(), "t_book").UseBus(evt.NewBus())
+	id, err := table.Insert(FieldMap{"name":"golang", "price":9.9})
+	if err != nil || id != 3 {
+		t.Fatalf("expect id 3, got %d, err:%v", id, err)
+	}
+	row, err := table.Get(nil, WhereMap{"id":Q.IN([]int{1, 2})})
+	if err != nil {
+		t.Fatalf("err:%v", err)
+	}
+	result, err := row.GetResult()
+	if err != nil {
+		t.Fatalf("err:%v", err)
+	}
+	if id, _ := result.GetInt64("id"); id != 1 {
+		t.Fatalf("bad result:%v", result)
+	}
+	if _, err = table.Delete(WhereMap{"id":Q.EQ(1)}); err == nil || err.Error() != "locked" {
+		t.Fatalf("expect locked, got %v", err)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("err:%v", err)
+	}
+}
+
+func TestMock_Unexpected(t *testing.T) {
+	mock := NewMock("mysql")
+	mock.Expect("UPDATE t_book SET name=? WHERE id  = ?").WithArgs("go", 1)
+	mock.Expect("DELETE FROM t_book")
+
+	table := NewSimpleTable(mock.Tx(), "t_book").UseBus(evt.NewBus())
+	// out of order
+	if _, err := table.Exec("DELETE FROM t_book"); err == nil {
+		t.Fatalf("expect unexpected statement")
+	}
+	if err := mock.ExpectationsWereMet(); err == nil {
+		t.Fatalf("expect error")
+	}
+
+	mock = NewMock("mysql").Unordered()
+	mock.Expect("UPDATE t_book SET name=? WHERE id  = ?").WithArgs("go", 1)
+	mock.Expect("DELETE FROM t_book")
+	table = NewSimpleTable(mock.Tx(), "t_book").UseBus(evt.NewBus())
+	if _, err := table.Exec("DELETE FROM t_book"); err != nil {
+		t.Fatalf("err:%v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err == nil {
+		t.Fatalf("expect update not met")
+	}
+	if _, err := table.Update(FieldMap{"name":"go"}, WhereMap{"id":Q.EQ(1)}); err != nil {
+		t.Fatalf("err:%v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("err:%v", err)
+	}
+}
+
+func TestMock_BadValue(t *testing.T) {
+	mock := NewMock("mysql")
+	mock.ExpectRegexp(`^SELECT`).ReturnRows([]string{"id"}, []interface{}{struct{}{}})
+
+	table := NewSimpleTable(mock.Tx(), "t_book").UseBus(evt.NewBus())
+	if _, err := table.Get(nil); err == nil || !strings.Contains(err.Error(), "bad value") {
+		t.Fatalf("expect bad value, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err == nil || !strings.Contains(err.Error(), "bad value") {
+		t.Fatalf("expect bad value, got %v", err)
+	}
+}
@@ -0,0 +1,261 @@
+// Package nplusone serves a development subscriber detecting N+1 queries of `dbutils`,
+// that is the same statement run again and again with different args
+// in a request or a transaction, which ought to be one `Q.IN` query
+package nplusone
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/argpass/dbutils"
+	"github.com/argpass/dbutils/evt"
+)
+
+// Report is a statement detected running repeatedly in a scope
+type Report struct {
+	Fingerprint string
+	Table       string
+	Method      string
+	// TxID is the id of the transaction of the scope, 0 for a context scope
+	TxID        uint64
+	// Count is the number of runs with distinct args when detected
+	Count       int
+	// Args are the distinct args of the runs
+	Args        [][]interface{}
+	// Stack is the call-site of the run reaching the threshold
+	Stack       string
+}
+
+func (r *Report) String() string {
+	return fmt.Sprintf("N+1 query: %s of %s run %d times with distinct args, fingerprint:%s\n%s",
+		r.Method, r.Table, r.Count, r.Fingerprint, r.Stack)
+}
+
+// Options configures a `Detector`
+type Options struct {
+	// Threshold is the number of distinct args of a statement to report it, 3 by default
+	Threshold int
+	// Ops are the operations watched, selects by default
+	Ops       []dbutils.Op
+	// Report receives reports, they are logged by default
+	Report    func(report *Report)
+}
+
+type statement struct {
+	seen     map[string]bool
+	// args are distinct args in order of runs
+	args     [][]interface{}
+	reported bool
+}
+
+type scope struct {
+	lock       sync.Mutex
+	statements map[string]*statement
+}
+
+type scopeKey struct{}
+
+// Detector watches sql events of scopes and reports N+1 queries.
+// A scope is a context returned by `Detector.Scope` or a `dbutils.Tx`,
+// statements out of any scope are ignored.
+//
+// Example:
+//   detector := nplusone.New(nplusone.Options{Threshold: 5})
+//   dbutils.Before(detector.Hook())
+//   detector.Subscribe(nil)
+//   http.Handle("/books", detector.Middleware(booksHandler))
+//   // in booksHandler
+//   table = table.WithContext(r.Context())
+//
+// The call-site is captured with the statement by `Detector.Hook`,
+// without the hook it is captured by the handler which works only
+// on a bus dispatching events synchronously.
+type Detector struct {
+	opts   Options
+	lock   sync.Mutex
+	txs    map[uint64]*scope
+}
+
+// New creates a `Detector`
+func New(opts Options) *Detector {
+	if opts.Threshold <= 0 {
+		opts.Threshold = 3
+	}
+	if opts.Ops == nil {
+		opts.Ops = []dbutils.Op{dbutils.OpSelect}
+	}
+	if opts.Report == nil {
+		opts.Report = func(report *Report) {
+			log.Println(report)
+		}
+	}
+	return &Detector{opts:opts, txs:map[uint64]*scope{}}
+}
+
+// Scope returns a context starting a scope, statements of tables using the context
+// are watched together
+func (d *Detector) Scope(ctx context.Context) context.Context {
+	return context.WithValue(ctx, scopeKey{}, &scope{statements:map[string]*statement{}})
+}
+
+// Middleware runs every request of `next` in a scope
+func (d *Detector) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(d.Scope(r.Context())))
+	})
+}
+
+// Hook makes tables capture the call-site of statements for reports
+func (d *Detector) Hook() dbutils.Hook {
+	return func(stmt *dbutils.Statement, next func(*dbutils.Statement) error) error {
+		stmt.CaptureCaller = true
+		return next(stmt)
+	}
+}
+
+// Subscribe connects the detector with sql and transaction events of `bus`
+// (the default bus if nil)
+func (d *Detector) Subscribe(bus *evt.Bus) *evt.Subscription {
+	if bus == nil {
+		bus = evt.Default()
+	}
+	return bus.SubscribeAll(d.Handler())
+}
+
+// Handler returns the `evt.EventHandler` of the detector
+func (d *Detector) Handler() evt.EventHandler {
+	return func(e evt.Event) (result interface{}) {
+		switch ev := e.(type) {
+		case *dbutils.SQLEvent:
+			d.Handle(ev)
+		case *dbutils.TxCommitEvent:
+			d.endTx(ev.TxID)
+		case *dbutils.TxRollbackEvent:
+			d.endTx(ev.TxID)
+		}
+		return nil
+	}
+}
+
+// Handle watches the event and reports the statement if it reaches the threshold
+func (d *Detector) Handle(ev *dbutils.SQLEvent) {
+	if !d.watched(ev.Op) {
+		return
+	}
+	s := d.scopeOf(ev)
+	if s == nil {
+		return
+	}
+	fingerprint := ev.Fingerprint
+	if fingerprint == "" {
+		fingerprint = dbutils.Fingerprint(ev.Query)
+	}
+
+	s.lock.Lock()
+	stmt, ok := s.statements[fingerprint]
+	if !ok {
+		stmt = &statement{seen:map[string]bool{}}
+		s.statements[fingerprint] = stmt
+	}
+	// redacted args of distinct values look the same, tell them by the raw ones
+	if key := fmt.Sprintf("%#v", ev.RawArgs()); !stmt.seen[key] {
+		stmt.seen[key] = true
+		stmt.args = append(stmt.args, ev.Args)
+	}
+	if stmt.reported || len(stmt.args) < d.opts.Threshold {
+		s.lock.Unlock()
+		return
+	}
+	stmt.reported = true
+	report := &Report{Fingerprint:fingerprint, Table:ev.Table, Method:ev.Method, TxID:ev.TxID,
+		Count:len(stmt.args), Args:append([][]interface{}(nil), stmt.args...)}
+	s.lock.Unlock()
+
+	if ev.Caller != nil {
+		report.Stack = format(ev.Caller)
+	}else {
+		report.Stack = callSite()
+	}
+	d.opts.Report(report)
+}
+
+func (d *Detector) watched(op dbutils.Op) bool {
+	for _, watched := range d.opts.Ops {
+		if watched == op {
+			return true
+		}
+	}
+	return false
+}
+
+// scopeOf returns the scope of the event, the context scope goes first
+func (d *Detector) scopeOf(ev *dbutils.SQLEvent) *scope {
+	if ev.Context != nil {
+		if s, ok := ev.Context.Value(scopeKey{}).(*scope); ok {
+			return s
+		}
+	}
+	if ev.TxID == 0 {
+		return nil
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	s, ok := d.txs[ev.TxID]
+	if !ok {
+		s = &scope{statements:map[string]*statement{}}
+		d.txs[ev.TxID] = s
+	}
+	return s
+}
+
+func (d *Detector) endTx(txID uint64) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	delete(d.txs, txID)
+}
+
+// internal packages are left out of the call-site
+var internals = []string{
+	"runtime.",
+	"github.com/argpass/dbutils.",
+	"github.com/argpass/dbutils/evt.",
+	"github.com/argpass/dbutils/nplusone.",
+}
+
+// callSite formats the stack of the handler, that is the caller running
+// the statement if events are dispatched synchronously
+func callSite() string {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(2, pcs)
+	return format(pcs[:n])
+}
+
+// format formats the stack of program counters
+func format(pcs []uintptr) string {
+	frames := runtime.CallersFrames(pcs)
+	var b strings.Builder
+	for {
+		frame, more := frames.Next()
+		if !isInternal(frame.Function) {
+			fmt.Fprintf(&b, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		}
+		if !more {
+			break
+		}
+	}
+	return b.String()
+}
+
+func isInternal(function string) bool {
+	for _, prefix := range internals {
+		if strings.HasPrefix(function, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package nplusone
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/argpass/dbutils"
+	"github.com/argpass/dbutils/Q"
+	"github.com/argpass/dbutils/dbtest"
+	"github.com/argpass/dbutils/evt"
+	"github.com/jmoiron/sqlx"
+)
+
+func TestDetector(t *testing.T) {
+	var reports []*Report
+	d := New(Options{Threshold:3, Report:func(report *Report) {
+		reports = append(reports, report)
+	}})
+	bus := evt.NewBus()
+	d.Subscribe(bus)
+
+	ctx := d.Scope(context.Background())
+	get := func(ctx context.Context, txID uint64, id int) {
+		bus.Send(&dbutils.SQLEvent{Query:"SELECT * FROM t_book WHERE id = ?", Args:[]interface{}{id},
+			Op:dbutils.OpSelect, Table:"t_book", Method:"Get", TxID:txID, Context:ctx})
+	}
+	// no scope
+	for i := 0; i < 5; i++ {
+		get(context.Background(), 0, i)
+	}
+	// same args are counted once
+	get(ctx, 0, 1)
+	get(ctx, 0, 1)
+	get(ctx, 0, 2)
+	if len(reports) != 0 {
+		t.Fatalf("unexpected reports:%v", reports)
+	}
+	for i := 3; i < 6; i++ {
+		get(ctx, 0, i)
+	}
+	if len(reports) != 1 || reports[0].Count != 3 || len(reports[0].Args) != 3 || reports[0].Stack == "" {
+		t.Fatalf("expect one report, got %+v", reports)
+	}
+
+	// a transaction is a scope until it ends
+	get(context.Background(), 7, 1)
+	get(context.Background(), 7, 2)
+	bus.Send(&dbutils.TxCommitEvent{TxID:7})
+	get(context.Background(), 7, 3)
+	if len(reports) != 1 {
+		t.Fatalf("unexpected reports:%v", reports)
+	}
+}
+
+func TestDetector_Hook(t *testing.T) {
+	schema := dbtest.Schema{Create:map[Q.Dialect]string{
+		Q.SQLite:"CREATE TABLE nplusone_t_book(id INTEGER PRIMARY KEY, name VARCHAR(100))",
+		Q.MySQL:"CREATE TABLE nplusone_t_book(id INTEGER PRIMARY KEY, name VARCHAR(100))",
+	}, Drop:map[Q.Dialect]string{
+		Q.MySQL:"DROP TABLE IF EXISTS nplusone_t_book",
+	}}
+	dbtest.Run(t, schema, func(t *testing.T, tx *sqlx.Tx) {
+		var reports []*Report
+		d := New(Options{Threshold:2, Report:func(report *Report) {
+			reports = append(reports, report)
+		}})
+		// the handler runs in another goroutine, the call-site comes with the event
+		dispatcher := evt.NewAsyncDispatcher(evt.AsyncOptions{})
+		bus := evt.NewBus()
+		bus.SubscribeAll(dispatcher.Handler(d.Handler()))
+
+		table := dbutils.NewSimpleTable(tx, "nplusone_t_book").UseBus(bus).Before(d.Hook()).
+			WithContext(d.Scope(context.Background()))
+		for i := 0; i < 2; i++ {
+			if _, err := table.Get(nil, dbutils.WhereMap{"id":Q.EQ(i)}); err != nil {
+				t.Fatalf("err:%v", err)
+			}
+		}
+		dispatcher.Close()
+		if len(reports) != 1 || !strings.Contains(reports[0].Stack, "testing.tRunner") {
+			t.Fatalf("expect a report with the call-site of the statement, got %+v", reports)
+		}
+	})
+}
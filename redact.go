@@ -0,0 +1,226 @@
+package dbutils
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"github.com/argpass/dbutils/Q"
+	"github.com/argpass/dbutils/internal/sorted"
+)
+
+// REDACTED replaces values of sensitive columns in sql events
+const REDACTED = "[REDACTED]"
+
+type redactPolicy struct {
+	sync.RWMutex
+	patterns []*regexp.Regexp
+}
+
+var globalRedaction = &redactPolicy{}
+
+// RedactColumns marks columns of all tables matching any of `patterns`
+// (case-insensitive regular expressions) sensitive,
+// their values are replaced with `REDACTED` in sql events
+// while the real values still go to the driver.
+// Args of `SimpleTable.Exec` are never redacted, the table knows no column of them
+//
+// Example:
+//   dbutils.RedactColumns(`password`, `^(email|phone)$`)
+func RedactColumns(patterns ...string) error {
+	var compiled []*regexp.Regexp
+	for _, pattern := range patterns {
+		re, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return err
+		}
+		compiled = append(compiled, re)
+	}
+	globalRedaction.Lock()
+	defer globalRedaction.Unlock()
+	globalRedaction.patterns = append(globalRedaction.patterns, compiled...)
+	return nil
+}
+
+// ResetRedaction removes all patterns added by `RedactColumns`
+func ResetRedaction() {
+	globalRedaction.Lock()
+	defer globalRedaction.Unlock()
+	globalRedaction.patterns = nil
+}
+
+func (r *redactPolicy) enabled() bool {
+	r.RLock()
+	defer r.RUnlock()
+	return len(r.patterns) > 0
+}
+
+func (r *redactPolicy) match(column string) bool {
+	r.RLock()
+	defer r.RUnlock()
+	for _, re := range r.patterns {
+		if re.MatchString(column) {
+			return true
+		}
+	}
+	return false
+}
+
+// Sensitive marks `columns` of the table sensitive,
+// their values are replaced with `REDACTED` in sql events
+func (p *SimpleTable) Sensitive(columns ...string) *SimpleTable {
+	sensitive := make(map[string]bool, len(p.sensitive) + len(columns))
+	for column := range p.sensitive {
+		sensitive[column] = true
+	}
+	for _, column := range columns {
+		sensitive[strings.ToLower(column)] = true
+	}
+	p.sensitive = sensitive
+	return p
+}
+
+// redacting tells if any column may be sensitive
+func (p *SimpleTable) redacting() bool {
+	return len(p.sensitive) > 0 || globalRedaction.enabled()
+}
+
+// isSensitive tells if `column` ("a,b" for more columns) is sensitive
+func (p *SimpleTable) isSensitive(column string) bool {
+	for _, name := range strings.Split(column, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if p.sensitive[name] || globalRedaction.match(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// SensitiveArg is an arg of a sensitive column,
+// the table wraps such args before hooks run so the tag follows the value
+// however hooks reorder or add args,
+// they are unwrapped before the statement is sent to the driver
+type SensitiveArg struct {
+	Value interface{}
+}
+
+// tag returns a copy of `args` with values of sensitive columns wrapped in `SensitiveArg`,
+// `cols` are the columns of args
+func (p *SimpleTable) tag(args []interface{}, cols []string) []interface{} {
+	var tagged []interface{}
+	for i, column := range cols {
+		if i >= len(args) {
+			break
+		}
+		if column != "" && p.isSensitive(column) {
+			if tagged == nil {
+				tagged = append([]interface{}(nil), args...)
+			}
+			tagged[i] = SensitiveArg{Value:args[i]}
+		}
+	}
+	if tagged == nil {
+		return args
+	}
+	return tagged
+}
+
+// untag returns the real values of `args` and a copy with `SensitiveArg` replaced by `REDACTED`,
+// both are `args` itself if no arg is sensitive
+func untag(args []interface{}) (raw []interface{}, redacted []interface{}) {
+	for i, arg := range args {
+		sensitive, ok := arg.(SensitiveArg)
+		if !ok {
+			continue
+		}
+		if raw == nil {
+			raw = append([]interface{}(nil), args...)
+			redacted = append([]interface{}(nil), args...)
+		}
+		raw[i], redacted[i] = sensitive.Value, REDACTED
+	}
+	if raw == nil {
+		return args, args
+	}
+	return raw, redacted
+}
+
+// The functions below walk the input of builders in the same order as them,
+// they return the column of every arg the builders return.
+
+// appendColumns appends `column` for the args `render` adds
+func appendColumns(cols []string, args []interface{}, column string,
+		render func(args []interface{}) []interface{}) ([]string, []interface{}) {
+	before := len(args)
+	args = render(args)
+	for i := before; i < len(args); i++ {
+		cols = append(cols, column)
+	}
+	return cols, args
+}
+
+func whereColumns(dialect Q.Dialect, cols []string, args []interface{}, where WhereMap) ([]string, []interface{}) {
+	for _, name := range sorted.Keys(where) {
+		caller := where[name]
+		cols, args = appendColumns(cols, args, name, func(args []interface{}) []interface{} {
+			_, args = Q.Render(caller, dialect, name, args)
+			return args
+		})
+	}
+	return cols, args
+}
+
+func insertColumns(fieldsMap FieldMap) []string {
+	return sorted.Keys(fieldsMap)
+}
+
+func insertManyColumns(fieldValues FieldValuesMap) []string {
+	names := sorted.Keys(fieldValues)
+	if len(names) == 0 {
+		return nil
+	}
+	var cols []string
+	for i := 0; i < len(fieldValues[names[0]]); i++ {
+		cols = append(cols, names...)
+	}
+	return cols
+}
+
+func updateColumns(dialect Q.Dialect, fieldsMap FieldMap, where WhereMap) []string {
+	var cols []string
+	var args []interface{}
+	for _, name := range sorted.Keys(fieldsMap) {
+		value := fieldsMap[name]
+		cols, args = appendColumns(cols, args, name, func(args []interface{}) []interface{} {
+			if setter, ok := value.(Q.Setter); ok {
+				_, args = setter.Set(dialect, name, args)
+				return args
+			}
+			return append(args, value)
+		})
+	}
+	cols, _ = whereColumns(dialect, cols, args, where)
+	return cols
+}
+
+func queryColumns(dialect Q.Dialect, where WhereMap, opts []Q.Option) []string {
+	var cols []string
+	var args []interface{}
+	for _, opt := range opts {
+		if column, ok := opt.(Q.Column); ok {
+			// args of a selected expression belong to no column unless it matches columns
+			name := ""
+			if matcher, ok := column.(Q.Matcher); ok {
+				name = matcher.Matched()
+			}
+			cols, args = appendColumns(cols, args, name, func(args []interface{}) []interface{} {
+				_, args = column.Column(dialect, args)
+				return args
+			})
+		}
+	}
+	cols, _ = whereColumns(dialect, cols, args, where)
+	return cols
+}
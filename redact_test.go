@@ -0,0 +1,79 @@
+package dbutils
+
+import (
+	"testing"
+	"strings"
+	"github.com/jmoiron/sqlx"
+	"github.com/argpass/dbutils/Q"
+	"github.com/argpass/dbutils/dbtest"
+	"github.com/argpass/dbutils/evt"
+)
+
+func TestRedact_Update(t *testing.T) {
+	defer ResetRedaction()
+	if err := RedactColumns(`^ta(g|gs)$`); err != nil {
+		t.Fatalf("err:%v", err)
+	}
+	dbtest.Run(t, test_scheme, func(t *testing.T, tx *sqlx.Tx){
+		var events []*SQLEvent
+		bus := evt.NewBus()
+		evt.On(bus, func(e *SQLEvent) {
+			events = append(events, e)
+		})
+		table := NewSimpleTable(tx, t_book).UseBus(bus).Sensitive("Name")
+		table.Insert(FieldMap{"name": "Python", "tag": 1})
+		// the hook prepends an arg, sensitive args are still told by their tag
+		table.Before(func(stmt *Statement, next func(*Statement) error) error {
+			if stmt.Method == "Update" {
+				stmt.Query = strings.Replace(stmt.Query, "SET ", "SET deleted=?,", 1)
+				stmt.Args = append([]interface{}{true}, stmt.Args...)
+			}
+			return next(stmt)
+		})
+		affected, err := table.Update(FieldMap{"name": "Golang"}, WhereMap{"tag": Q.EQ(1)})
+		if err != nil || affected != 1 {
+			t.Fatalf("\n[update] affected:%d, err:%v\n", affected, err)
+		}
+		table.Exec("UPDATE " + t_book + " SET name=? WHERE tag=?", "Ruby", 2)
+
+		if len(events) != 3 {
+			t.Fatalf("\n expect 3 events got %d\n", len(events))
+		}
+		expect := func(event *SQLEvent, args, raw []interface{}) {
+			if len(event.Args) != len(args) || len(event.RawArgs()) != len(raw) {
+				t.Fatalf("\n expect args %v, raw %v, got %v, %v\n", args, raw, event.Args, event.RawArgs())
+			}
+			for i := range args {
+				if event.Args[i] != args[i] || event.RawArgs()[i] != raw[i] {
+					t.Fatalf("\n expect args %v, raw %v, got %v, %v\n", args, raw, event.Args, event.RawArgs())
+				}
+			}
+		}
+		expect(events[0], []interface{}{REDACTED, REDACTED}, []interface{}{"Python", 1})
+		expect(events[1], []interface{}{true, REDACTED, REDACTED}, []interface{}{true, "Golang", 1})
+		// args of raw statements are never redacted
+		expect(events[2], []interface{}{"Ruby", 2}, []interface{}{"Ruby", 2})
+
+		// the driver gets the real values
+		var name string
+		var deleted bool
+		if err = tx.QueryRow("SELECT name, deleted FROM " + t_book).Scan(&name, &deleted); err != nil {
+			t.Fatalf("\n[select] err:%v\n", err)
+		}
+		if name != "Golang" || !deleted {
+			t.Fatalf("\n expect Golang deleted, got %s, %v\n", name, deleted)
+		}
+	})
+}
+
+func TestRedact_MatchScore(t *testing.T) {
+	table := NewSimpleTable(nil, t_book).Sensitive("name")
+	where := WhereMap{"name": Q.Match("golang", Q.NaturalMode)}
+	opts := []Q.Option{Q.MatchScore("score", "name", "golang", Q.NaturalMode)}
+	_, args := BuildQuerySQLFor(Q.MySQL, t_book, where, nil, Q.Limit{}, opts...)
+	tagged := table.tag(args, queryColumns(Q.MySQL, where, opts))
+	_, redacted := untag(tagged)
+	if len(redacted) != 2 || redacted[0] != REDACTED || redacted[1] != REDACTED {
+		t.Fatalf("\n expect search terms redacted, got %v\n", redacted)
+	}
+}
@@ -0,0 +1,119 @@
+package replay
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/argpass/dbutils"
+	"github.com/argpass/dbutils/internal/fakedb"
+	"github.com/jmoiron/sqlx"
+)
+
+// Replayer serves recorded statements by a fake database.
+// A statement is answered by the first record not replayed yet with the same query and args,
+// so statements interleaved (e.g. selects while scanning rows) are replayed in any order.
+// Args redacted when recording match any value.
+//
+// Example:
+//   replayer, _ := replay.LoadFile("testdata/books.jsonl")
+//   db := replayer.Open("mysql")
+//   tx, _ := db.Beginx()
+//   table := dbutils.NewSimpleTable(tx, "t_book")
+//   ...
+//   if err := replayer.Done(); err != nil {
+//       t.Fatal(err)
+//   }
+type Replayer struct {
+	lock     sync.Mutex
+	records  []*Record
+	replayed []bool
+}
+
+// NewReplayer creates a `Replayer` of `records`
+func NewReplayer(records []*Record) *Replayer {
+	return &Replayer{records:records, replayed:make([]bool, len(records))}
+}
+
+// Open returns a database replaying the records,
+// `driverName` is the driver recorded, it picks the dialect of tables
+func (p *Replayer) Open(driverName string) *sqlx.DB {
+	return fakedb.Open(driverName, p.replay)
+}
+
+// Done returns an error if any record is not replayed
+func (p *Replayer) Done() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for i, replayed := range p.replayed {
+		if !replayed {
+			return fmt.Errorf("replay: statement %d not replayed: %s", i, p.records[i].Query)
+		}
+	}
+	return nil
+}
+
+// replay answers the statement by its record
+func (p *Replayer) replay(query string, args []driver.Value) (*fakedb.Answer, error) {
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg
+	}
+	converted := valuesOf(values)
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	var expected *Record
+	for i, record := range p.records {
+		if p.replayed[i] {
+			continue
+		}
+		if expected == nil {
+			expected = record
+		}
+		if record.Query == query && matchArgs(record.Args, converted) {
+			p.replayed[i] = true
+			if record.Error != "" {
+				return nil, errors.New(record.Error)
+			}
+			return answerOf(record), nil
+		}
+	}
+	if expected == nil {
+		return nil, fmt.Errorf("replay: unexpected statement %s %v", query, values)
+	}
+	return nil, fmt.Errorf("replay: unexpected statement %s %v, next is %s", query, values, expected.Query)
+}
+
+// matchArgs tells if recorded args match `args`
+func matchArgs(recorded []Value, args []Value) bool {
+	if len(recorded) != len(args) {
+		return false
+	}
+	for i := range recorded {
+		if recorded[i].V == dbutils.REDACTED {
+			continue
+		}
+		expected, _ := json.Marshal(recorded[i])
+		actual, _ := json.Marshal(args[i])
+		if string(expected) != string(actual) {
+			return false
+		}
+	}
+	return true
+}
+
+// answerOf is the answer of `record`
+func answerOf(record *Record) *fakedb.Answer {
+	answer := &fakedb.Answer{LastInsertID:record.LastInsertID, RowsAffected:record.Rows,
+		Columns:record.Columns}
+	for _, values := range record.Values {
+		row := make([]driver.Value, len(values))
+		for i, value := range values {
+			row[i] = value.V
+		}
+		answer.Rows = append(answer.Rows, row)
+	}
+	return answer
+}
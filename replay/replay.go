@@ -0,0 +1,139 @@
+// Package replay records sql traffic of `dbutils` to a JSON lines file
+// and replays it against `SimpleTable` without a database
+package replay
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/argpass/dbutils"
+	"github.com/argpass/dbutils/evt"
+)
+
+// Record is a statement in the JSON lines file
+type Record struct {
+	Query        string     `json:"query"`
+	Args         []Value    `json:"args"`
+	Table        string     `json:"table,omitempty"`
+	Method       string     `json:"method,omitempty"`
+	// Rows is the number of rows affected or returned
+	Rows         int64      `json:"rows"`
+	LastInsertID int64      `json:"last_insert_id,omitempty"`
+	Columns      []string   `json:"columns,omitempty"`
+	Values       [][]Value  `json:"values,omitempty"`
+	Error        string     `json:"error,omitempty"`
+}
+
+// Recorder is the subscriber writing sql events as records
+//
+// Example:
+//   f, _ := os.Create("testdata/books.jsonl")
+//   recorder := replay.NewRecorder(f)
+//   // capture rows returned by selects
+//   dbutils.Before(recorder.Hook())
+//   recorder.Subscribe(nil)
+type Recorder struct {
+	lock sync.Mutex
+	enc  *json.Encoder
+}
+
+// NewRecorder creates a `Recorder` writing to `w`
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{enc:json.NewEncoder(w)}
+}
+
+// Hook makes tables capture rows returned by selects for the recorder
+func (r *Recorder) Hook() dbutils.Hook {
+	return func(stmt *dbutils.Statement, next func(*dbutils.Statement) error) error {
+		stmt.CaptureRows = true
+		return next(stmt)
+	}
+}
+
+// Subscribe connects the recorder with sql and rows events of `bus` (the default bus if nil)
+func (r *Recorder) Subscribe(bus *evt.Bus) *evt.Subscription {
+	if bus == nil {
+		bus = evt.Default()
+	}
+	return bus.SubscribeAll(r.Handler())
+}
+
+// Handler returns the `evt.EventHandler` of the recorder,
+// it returns the error of writing.
+// A select is recorded with its rows by its `dbutils.RowsEvent`,
+// so selects whose rows are never consumed are left out
+func (r *Recorder) Handler() evt.EventHandler {
+	return func(e evt.Event) (result interface{}) {
+		var ev *dbutils.SQLEvent
+		switch e := e.(type) {
+		case *dbutils.SQLEvent:
+			if e.RowsPending {
+				return nil
+			}
+			ev = e
+		case *dbutils.RowsEvent:
+			ev = e.Event
+		default:
+			return nil
+		}
+		if err := r.Record(ev); err != nil {
+			return err
+		}
+		return nil
+	}
+}
+
+// Record writes the event, statements aborted by hooks are left out
+func (r *Recorder) Record(ev *dbutils.SQLEvent) error {
+	if ev.Aborted {
+		return nil
+	}
+	record := &Record{Query:ev.Query, Args:valuesOf(ev.Args), Table:ev.Table, Method:ev.Method,
+		Rows:ev.Rows, Columns:ev.Columns}
+	for _, values := range ev.Values {
+		record.Values = append(record.Values, valuesOf(values))
+	}
+	if ev.Result != nil {
+		record.LastInsertID, _ = ev.Result.LastInsertId()
+	}
+	if ev.Error != nil {
+		record.Error = ev.Error.Error()
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.enc.Encode(record)
+}
+
+// Load reads records from `r`
+func Load(r io.Reader) (*Replayer, error) {
+	var records []*Record
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64 * 1024), 64 * 1024 * 1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		record := &Record{}
+		if err := json.Unmarshal(scanner.Bytes(), record); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return NewReplayer(records), nil
+}
+
+// LoadFile reads records from the file `path`
+func LoadFile(path string) (*Replayer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Load(f)
+}
@@ -0,0 +1,153 @@
+package replay
+
+import (
+	"bytes"
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/argpass/dbutils"
+	"github.com/argpass/dbutils/Q"
+	"github.com/argpass/dbutils/dbtest"
+	"github.com/argpass/dbutils/evt"
+	"github.com/jmoiron/sqlx"
+)
+
+type fakeResult struct {
+	id, rows int64
+}
+
+func (r fakeResult) LastInsertId() (int64, error) {
+	return r.id, nil
+}
+
+func (r fakeResult) RowsAffected() (int64, error) {
+	return r.rows, nil
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	var buf bytes.Buffer
+	bus := evt.NewBus()
+	NewRecorder(&buf).Subscribe(bus)
+	insert, insertArgs, _ := dbutils.BuildInsertSQL("t_book", dbutils.FieldMap{"name":"golang", "price":1.5})
+	query, queryArgs := dbutils.BuildQuerySQLFor(Q.MySQL, "t_book",
+		dbutils.WhereMap{"id":Q.EQ(7)}, []string{"name", "price"}, Q.Limit{0, 1})
+	bus.Send(&dbutils.SQLEvent{Query:insert, Args:insertArgs, Result:fakeResult{7, 1}, Rows:1})
+	bus.Send(&dbutils.SQLEvent{Query:"DELETE FROM t_book", Aborted:true, Error:dbutils.READ_ONLY})
+	bus.Send(&dbutils.SQLEvent{Query:query, Args:queryArgs, Rows:1, Columns:[]string{"name", "price"},
+		Values:[][]interface{}{{[]byte("golang"), 1.5}}})
+
+	replayer, err := Load(&buf)
+	if err != nil {
+		t.Fatalf("err:%v", err)
+	}
+	tx, err := replayer.Open("mysql").Beginx()
+	if err != nil {
+		t.Fatalf("err:%v", err)
+	}
+	table := dbutils.NewSimpleTable(tx, "t_book").UseBus(evt.NewBus())
+	id, err := table.Insert(dbutils.FieldMap{"name":"golang", "price":1.5})
+	if err != nil || id != 7 {
+		t.Fatalf("expect id 7, got %d, err:%v", id, err)
+	}
+	// args differ from the record
+	if _, err = table.Get([]string{"name", "price"}, dbutils.WhereMap{"id":Q.EQ(8)}); err == nil {
+		t.Fatalf("expect unexpected statement")
+	}
+	row, err := table.Get([]string{"name", "price"}, dbutils.WhereMap{"id":Q.EQ(7)})
+	if err != nil {
+		t.Fatalf("err:%v", err)
+	}
+	var name string
+	var price float64
+	if err = row.Scan(&name, &price); err != nil || name != "golang" || price != 1.5 {
+		t.Fatalf("bad row %s %v, err:%v", name, price, err)
+	}
+	if err = replayer.Done(); err != nil {
+		t.Fatalf("err:%v", err)
+	}
+	if _, err = table.Exec("DELETE FROM t_book"); err == nil || err == sql.ErrNoRows {
+		t.Fatalf("expect unexpected statement, got %v", err)
+	}
+}
+
+func TestRecordJSONArgs(t *testing.T) {
+	var buf bytes.Buffer
+	_, args, _ := dbutils.WhereMap{"doc":Q.JSONContains(map[string]int{"a":1})}.BuildWhereBlock(nil)
+	NewRecorder(&buf).Record(&dbutils.SQLEvent{Query:"SELECT * FROM t_doc WHERE JSON_CONTAINS(doc, ?)", Args:args})
+	if !bytes.Contains(buf.Bytes(), []byte(`"args":["{\"a\":1}"]`)) {
+		t.Fatalf("expect the JSON arg recorded as its value, got %s", buf.String())
+	}
+}
+
+var bookSchema = dbtest.Schema{
+	Create: map[Q.Dialect]string{
+		Q.MySQL: `CREATE TABLE replay_t_book(id INTEGER AUTO_INCREMENT PRIMARY KEY,name VARCHAR(100) NOT NULL)`,
+		Q.SQLite: `CREATE TABLE replay_t_book(id INTEGER PRIMARY KEY AUTOINCREMENT,name VARCHAR(100) NOT NULL)`,
+	},
+	Drop: map[Q.Dialect]string{
+		Q.MySQL: "DROP TABLE IF EXISTS replay_t_book",
+	},
+}
+
+// runBooks runs the same statements on a real table and on a replayed one
+func runBooks(t *testing.T, table *dbutils.SimpleTable) (id int64, names []string) {
+	id, err := table.Insert(dbutils.FieldMap{"name":"golang"})
+	if err != nil {
+		t.Fatalf("[insert] err:%v", err)
+	}
+	table.InsertMany(dbutils.FieldValuesMap{"name":{"python", "ruby"}})
+	table.Update(dbutils.FieldMap{"name":"rust"}, dbutils.WhereMap{"name":Q.EQ("ruby")})
+	row, err := table.Get([]string{"name"}, dbutils.WhereMap{"id":Q.EQ(id)})
+	if err != nil {
+		t.Fatalf("[get] err:%v", err)
+	}
+	var name string
+	if err = row.Scan(&name); err != nil {
+		t.Fatalf("[scan] err:%v", err)
+	}
+	names = append(names, name)
+	rows, err := table.Query([]string{"name"}, dbutils.WhereMap{"id":Q.GT(id)})
+	if err != nil {
+		t.Fatalf("[query] err:%v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err = rows.Scan(&name); err != nil {
+			t.Fatalf("[scan] err:%v", err)
+		}
+		names = append(names, name)
+	}
+	return id, names
+}
+
+func TestRecordTable(t *testing.T) {
+	dbtest.Run(t, bookSchema, func(t *testing.T, tx *sqlx.Tx) {
+		var buf bytes.Buffer
+		bus := evt.NewBus()
+		recorder := NewRecorder(&buf)
+		recorder.Subscribe(bus)
+		table := dbutils.NewSimpleTable(tx, "replay_t_book").UseBus(bus).Before(recorder.Hook())
+		id, names := runBooks(t, table)
+		if len(names) != 3 || names[0] != "golang" || names[2] != "rust" {
+			t.Fatalf("bad names %v", names)
+		}
+
+		replayer, err := Load(&buf)
+		if err != nil {
+			t.Fatalf("err:%v", err)
+		}
+		replayTx, err := replayer.Open(tx.DriverName()).Beginx()
+		if err != nil {
+			t.Fatalf("err:%v", err)
+		}
+		replayed := dbutils.NewSimpleTable(replayTx, "replay_t_book").UseBus(evt.NewBus())
+		replayedID, replayedNames := runBooks(t, replayed)
+		if replayedID != id || strings.Join(replayedNames, ",") != strings.Join(names, ",") {
+			t.Fatalf("expect %d %v, got %d %v", id, names, replayedID, replayedNames)
+		}
+		if err = replayer.Done(); err != nil {
+			t.Fatalf("err:%v", err)
+		}
+	})
+}
@@ -0,0 +1,94 @@
+package replay
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Value is a driver value in records,
+// floats, bytes and times are tagged to be decoded with their types:
+//   null, true, 1, "text", {"float": 1.5}, {"bytes": "YWJj"}, {"time": "2006-01-02T15:04:05Z"}
+type Value struct {
+	V driver.Value
+}
+
+type taggedValue struct {
+	Float *float64   `json:"float,omitempty"`
+	Bytes []byte     `json:"bytes,omitempty"`
+	Time  *time.Time `json:"time,omitempty"`
+}
+
+// valueOf converts `v` to a driver value like `database/sql` does with args,
+// a `driver.Valuer` such as the JSON args of `Q` is recorded as the value it sends
+func valueOf(v interface{}) Value {
+	if valuer, ok := v.(driver.Valuer); ok {
+		if value, err := valuer.Value(); err == nil {
+			v = value
+		}
+	}
+	value, err := driver.DefaultParameterConverter.ConvertValue(v)
+	if err != nil {
+		value = fmt.Sprint(v)
+	}
+	return Value{V:value}
+}
+
+func valuesOf(values []interface{}) []Value {
+	converted := make([]Value, len(values))
+	for i, v := range values {
+		converted[i] = valueOf(v)
+	}
+	return converted
+}
+
+func (v Value) MarshalJSON() ([]byte, error) {
+	switch value := v.V.(type) {
+	case float64:
+		return json.Marshal(taggedValue{Float:&value})
+	case []byte:
+		return json.Marshal(taggedValue{Bytes:append([]byte{}, value...)})
+	case time.Time:
+		return json.Marshal(taggedValue{Time:&value})
+	default:
+		return json.Marshal(value)
+	}
+}
+
+func (v *Value) UnmarshalJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var raw interface{}
+	if err := dec.Decode(&raw); err != nil {
+		return err
+	}
+	switch value := raw.(type) {
+	case json.Number:
+		n, err := value.Int64()
+		if err != nil {
+			return fmt.Errorf("replay: bad integer %s", value)
+		}
+		v.V = n
+	case map[string]interface{}:
+		var tagged taggedValue
+		if err := json.Unmarshal(data, &tagged); err != nil {
+			return err
+		}
+		switch {
+		case tagged.Float != nil:
+			v.V = *tagged.Float
+		case tagged.Time != nil:
+			v.V = *tagged.Time
+		default:
+			if tagged.Bytes == nil {
+				tagged.Bytes = []byte{}
+			}
+			v.V = tagged.Bytes
+		}
+	default:
+		v.V = value
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+// Package slowlog serves a subscriber logging slow statements of `dbutils`
+package slowlog
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/argpass/dbutils"
+	"github.com/argpass/dbutils/Q"
+	"github.com/argpass/dbutils/evt"
+	"github.com/jmoiron/sqlx"
+)
+
+// Entry is a slow statement written to the sink
+type Entry struct {
+	Time       time.Time     `json:"time"`
+	Query      string        `json:"query"`
+	Fingerprint string       `json:"fingerprint"`
+	Args       []interface{} `json:"args"`
+	DurationMs float64       `json:"duration_ms"`
+	Table      string        `json:"table"`
+	Op         dbutils.Op    `json:"op"`
+	Method     string        `json:"method"`
+	// Rows is the number of rows affected, 0 for selects
+	Rows       int64         `json:"rows"`
+	TxID       uint64        `json:"tx_id,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	// Count is the number of slow runs of the statement since it was logged last time
+	Count      int           `json:"count"`
+	// Plan is the rows of EXPLAIN
+	Plan       []map[string]interface{} `json:"plan,omitempty"`
+	PlanError  string        `json:"plan_error,omitempty"`
+}
+
+// Sink receives slow statements
+type Sink interface {
+	Write(entry *Entry) error
+}
+
+// JSONSink writes entries to a writer as JSON lines
+type JSONSink struct {
+	lock sync.Mutex
+	enc  *json.Encoder
+}
+
+// NewJSONSink creates a `JSONSink` writing to `w`
+func NewJSONSink(w io.Writer) *JSONSink {
+	return &JSONSink{enc:json.NewEncoder(w)}
+}
+
+func (p *JSONSink) Write(entry *Entry) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.enc.Encode(entry)
+}
+
+// Options configures a `Logger`
+type Options struct {
+	// Threshold is the duration a statement must reach to be logged
+	Threshold   time.Duration
+	// DedupWindow logs a statement fingerprint once per window, later slow runs are counted
+	// and reported by the next entry. A statement not logged again after the window is
+	// forgotten, its suppressed runs are reported by the entry of the last one. 0 logs every slow run
+	DedupWindow time.Duration
+	// ExplainDB runs EXPLAIN for slow selects if it is set,
+	// it ought to be a pool apart from the one running the statements
+	ExplainDB   *sqlx.DB
+	Sink        Sink
+}
+
+type seen struct {
+	logged     time.Time
+	suppressed int
+	// last is the entry of the last suppressed run
+	last       *Entry
+}
+
+// Logger is the subscriber logging slow statements
+//
+// Example:
+//   logger := slowlog.New(slowlog.Options{
+//       Threshold: 100 * time.Millisecond,
+//       DedupWindow: time.Minute,
+//       ExplainDB: explainDB,
+//       Sink: slowlog.NewJSONSink(os.Stderr),
+//   })
+//   // explain slow selects off the caller goroutine
+//   d := evt.NewAsyncDispatcher(evt.AsyncOptions{})
+//   evt.Default().Subscribe((*dbutils.SQLEvent)(nil), d.Handler(logger.Handler()))
+type Logger struct {
+	opts Options
+	lock sync.Mutex
+	seen map[string]*seen
+	now  func() time.Time
+}
+
+// New creates a `Logger`
+func New(opts Options) *Logger {
+	return &Logger{opts:opts, seen:map[string]*seen{}, now:time.Now}
+}
+
+// Subscribe connects the logger with sql events of `bus` (the default bus if nil)
+func (l *Logger) Subscribe(bus *evt.Bus) *evt.Subscription {
+	if bus == nil {
+		bus = evt.Default()
+	}
+	return bus.Subscribe((*dbutils.SQLEvent)(nil), l.Handler())
+}
+
+// Handler returns the `evt.EventHandler` of the logger,
+// it returns the error of the sink
+func (l *Logger) Handler() evt.EventHandler {
+	return func(e evt.Event) (result interface{}) {
+		if ev, ok := e.(*dbutils.SQLEvent); ok {
+			if err := l.Handle(ev); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Handle logs the event if it is slow
+func (l *Logger) Handle(ev *dbutils.SQLEvent) error {
+	if ev.Duration < l.opts.Threshold || l.opts.Sink == nil {
+		return nil
+	}
+	fingerprint := ev.Fingerprint
+	if fingerprint == "" {
+		fingerprint = dbutils.Fingerprint(ev.Query)
+	}
+	entry := &Entry{Time:ev.Start, Query:ev.Query, Fingerprint:fingerprint, Args:argsOf(ev.Args),
+		DurationMs:float64(ev.Duration) / float64(time.Millisecond),
+		Table:ev.Table, Op:ev.Op, Method:ev.Method, Rows:ev.Rows, TxID:ev.TxID}
+	if ev.Error != nil {
+		entry.Error = ev.Error.Error()
+	}
+	expired, ok := l.dedup(fingerprint, entry)
+	for _, last := range expired {
+		if err := l.opts.Sink.Write(last); err != nil {
+			return err
+		}
+	}
+	if !ok {
+		return nil
+	}
+	if l.opts.ExplainDB != nil && ev.Op == dbutils.OpSelect && ev.Error == nil {
+		plan, err := Explain(l.opts.ExplainDB, ev.Query, ev.RawArgs()...)
+		entry.Plan = plan
+		if err != nil {
+			entry.PlanError = err.Error()
+		}
+	}
+	return l.opts.Sink.Write(entry)
+}
+
+// argsOf replaces `driver.Valuer` args with their values,
+// JSON args of `Q` have no exported fields to marshal
+func argsOf(args []interface{}) []interface{} {
+	var converted []interface{}
+	for i, arg := range args {
+		valuer, ok := arg.(driver.Valuer)
+		if !ok {
+			continue
+		}
+		if value, err := valuer.Value(); err == nil {
+			if converted == nil {
+				converted = append([]interface{}(nil), args...)
+			}
+			converted[i] = value
+		}
+	}
+	if converted == nil {
+		return args
+	}
+	return converted
+}
+
+// dedup decides if `entry` of the statement `fingerprint` is logged now and sets its count,
+// it forgets other statements not logged in the window and returns the entries
+// of their suppressed runs
+func (l *Logger) dedup(fingerprint string, entry *Entry) (expired []*Entry, ok bool) {
+	entry.Count = 1
+	if l.opts.DedupWindow <= 0 {
+		return nil, true
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	now := l.now()
+	for key, s := range l.seen {
+		if key == fingerprint || now.Sub(s.logged) < l.opts.DedupWindow {
+			continue
+		}
+		delete(l.seen, key)
+		if s.suppressed > 0 {
+			s.last.Count = s.suppressed
+			expired = append(expired, s.last)
+		}
+	}
+	s, found := l.seen[fingerprint]
+	if found && now.Sub(s.logged) < l.opts.DedupWindow {
+		s.suppressed++
+		s.last = entry
+		return expired, false
+	}
+	if !found {
+		s = &seen{}
+		l.seen[fingerprint] = s
+	}
+	entry.Count = s.suppressed + 1
+	s.logged, s.suppressed, s.last = now, 0, nil
+	return expired, true
+}
+
+// Explain runs EXPLAIN of `query` on `db` and returns the plan rows,
+// it renders `EXPLAIN QUERY PLAN` on SQLite
+func Explain(db *sqlx.DB, query string, args ...interface{}) (plan []map[string]interface{}, err error) {
+	prefix := "EXPLAIN "
+	if Q.DialectOf(db.DriverName()) == Q.SQLite {
+		prefix = "EXPLAIN QUERY PLAN "
+	}
+	rows, err := db.Queryx(prefix + query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		row := map[string]interface{}{}
+		if err = rows.MapScan(row); err != nil {
+			return plan, err
+		}
+		for k, v := range row {
+			if b, ok := v.([]byte); ok {
+				row[k] = string(b)
+			}
+		}
+		plan = append(plan, row)
+	}
+	return plan, rows.Err()
+}
@@ -0,0 +1,84 @@
+package slowlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/argpass/dbutils"
+	"github.com/argpass/dbutils/Q"
+)
+
+func TestLogger_Handle(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(Options{Threshold:time.Second, DedupWindow:time.Minute, Sink:NewJSONSink(&buf)})
+	now := time.Now()
+	logger.now = func() time.Time { return now }
+
+	fast := &dbutils.SQLEvent{Query:"SELECT * FROM t_book", Duration:time.Millisecond}
+	slow := &dbutils.SQLEvent{Query:"SELECT * FROM t_book WHERE id = ?", Args:[]interface{}{1},
+		Duration:2 * time.Second, Op:dbutils.OpSelect, Table:"t_book"}
+	for _, ev := range []*dbutils.SQLEvent{fast, slow, slow, slow} {
+		if err := logger.Handle(ev); err != nil {
+			t.Fatalf("err:%v", err)
+		}
+	}
+	// the window passes, suppressed runs are reported
+	now = now.Add(2 * time.Minute)
+	logger.Handle(slow)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expect 2 entries got %d: %s", len(lines), buf.String())
+	}
+	var entry Entry
+	if err := json.Unmarshal([]byte(lines[1]), &entry); err != nil {
+		t.Fatalf("err:%v", err)
+	}
+	if entry.Count != 3 || entry.Query != slow.Query || entry.DurationMs != 2000 {
+		t.Fatalf("bad entry:%+v", entry)
+	}
+}
+
+func TestLogger_Evict(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(Options{Threshold:time.Second, DedupWindow:time.Minute, Sink:NewJSONSink(&buf)})
+	now := time.Now()
+	logger.now = func() time.Time { return now }
+
+	slow := &dbutils.SQLEvent{Query:"SELECT * FROM t_book WHERE id = ?", Duration:2 * time.Second}
+	other := &dbutils.SQLEvent{Query:"SELECT * FROM t_author WHERE id = ?", Duration:2 * time.Second}
+	logger.Handle(slow)
+	logger.Handle(slow)
+	logger.Handle(slow)
+	// the window passes, the statement is forgotten and its suppressed runs are flushed
+	now = now.Add(2 * time.Minute)
+	logger.Handle(other)
+	if len(logger.seen) != 1 {
+		t.Fatalf("expect 1 statement remembered, got %d", len(logger.seen))
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expect 3 entries got %d: %s", len(lines), buf.String())
+	}
+	var entry Entry
+	if err := json.Unmarshal([]byte(lines[1]), &entry); err != nil {
+		t.Fatalf("err:%v", err)
+	}
+	if entry.Count != 2 || entry.Query != slow.Query {
+		t.Fatalf("bad flushed entry:%+v", entry)
+	}
+}
+
+func TestLogger_HandleJSONArgs(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(Options{Sink:NewJSONSink(&buf)})
+	_, args, _ := dbutils.WhereMap{"doc":Q.JSONContains(map[string]int{"a":1})}.BuildWhereBlock(nil)
+	logger.Handle(&dbutils.SQLEvent{Query:"SELECT * FROM t_doc WHERE JSON_CONTAINS(doc, ?)", Args:args})
+	if !strings.Contains(buf.String(), `"args":["{\"a\":1}"]`) {
+		t.Fatalf("expect the JSON arg logged as its value, got %s", buf.String())
+	}
+}
@@ -0,0 +1,406 @@
+// Package snapshot takes contents of tables by `dbutils.SimpleTable`
+// to assert what an operation changes in tests
+package snapshot
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/argpass/dbutils"
+	"github.com/argpass/dbutils/evt"
+	"github.com/argpass/dbutils/internal/sorted"
+	"github.com/jmoiron/sqlx"
+)
+
+// UpdateEnv is the environment variable making `AssertGolden` write golden files
+const UpdateEnv = "DBUTILS_UPDATE_GOLDEN"
+
+// Snapshot is contents of tables
+type Snapshot struct {
+	// Tables are rows by table names
+	Tables map[string][]dbutils.Result
+}
+
+// use returns a table of `tx` whose statements are not published
+func use(tx *sqlx.Tx, table string) *dbutils.SimpleTable {
+	return dbutils.NewSimpleTable(tx, table).UseBus(evt.NewBus())
+}
+
+// Take queries all rows of `tables`
+func Take(tx *sqlx.Tx, tables ...string) (*Snapshot, error) {
+	s := &Snapshot{Tables:map[string][]dbutils.Result{}}
+	for _, table := range tables {
+		rows, err := use(tx, table).Query(nil)
+		if err != nil {
+			return nil, fmt.Errorf("snapshot %s: %v", table, err)
+		}
+		results := []dbutils.Result{}
+		for rows.Next() {
+			result, err := rows.GetResult()
+			if err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("snapshot %s: %v", table, err)
+			}
+			results = append(results, result)
+		}
+		if err = rows.Close(); err != nil {
+			return nil, fmt.Errorf("snapshot %s: %v", table, err)
+		}
+		s.Tables[table] = results
+	}
+	return s, nil
+}
+
+// String renders rows of tables in a stable order
+func (s *Snapshot) String() string {
+	var b strings.Builder
+	for _, table := range sorted.Keys(s.Tables) {
+		fmt.Fprintf(&b, "%s:\n", table)
+		rows := append([]dbutils.Result(nil), s.Tables[table]...)
+		sort.SliceStable(rows, func(i, j int) bool {
+			return formatRow(rows[i]) < formatRow(rows[j])
+		})
+		for _, row := range rows {
+			fmt.Fprintf(&b, "  %s\n", formatRow(row))
+		}
+	}
+	return b.String()
+}
+
+// Update is a row changed
+type Update struct {
+	// Key identifies the row, like `id=1`
+	Key     string
+	Before  dbutils.Result
+	After   dbutils.Result
+	// Columns are the columns changed
+	Columns []string
+}
+
+// TableDiff is the rows of a table changed
+type TableDiff struct {
+	Table    string
+	Inserted []dbutils.Result
+	Updated  []*Update
+	Deleted  []dbutils.Result
+}
+
+// Diff is the rows changed between two snapshots
+type Diff struct {
+	// Tables are tables changed in order of names
+	Tables []*TableDiff
+}
+
+// Empty tells if no row is changed
+func (d *Diff) Empty() bool {
+	return len(d.Tables) == 0
+}
+
+// Table returns the diff of `table`, nil if it is not changed
+func (d *Diff) Table(table string) *TableDiff {
+	for _, td := range d.Tables {
+		if td.Table == table {
+			return td
+		}
+	}
+	return nil
+}
+
+// String renders the diff like:
+//   t_book:
+//     + {id: 4, name: "Go"}
+//     ~ id=2: name: "Golang" -> "Go"
+//     - {id: 1, name: "Python"}
+func (d *Diff) String() string {
+	var b strings.Builder
+	for _, td := range d.Tables {
+		fmt.Fprintf(&b, "%s:\n", td.Table)
+		for _, row := range td.Inserted {
+			fmt.Fprintf(&b, "  + %s\n", formatRow(row))
+		}
+		for _, update := range td.Updated {
+			var changes []string
+			for _, column := range update.Columns {
+				changes = append(changes, fmt.Sprintf("%s: %s -> %s",
+					column, formatValue(update.Before[column]), formatValue(update.After[column])))
+			}
+			fmt.Fprintf(&b, "  ~ %s: %s\n", update.Key, strings.Join(changes, ", "))
+		}
+		for _, row := range td.Deleted {
+			fmt.Fprintf(&b, "  - %s\n", formatRow(row))
+		}
+	}
+	return b.String()
+}
+
+// Compare returns rows changed from `before` to `after`,
+// rows are identified by their `id` column,
+// or by all columns (so no row is updated) if there is no `id`,
+// then copies of a row are counted and extra or missing copies are inserted or deleted
+func Compare(before *Snapshot, after *Snapshot) *Diff {
+	return CompareBy(before, after, nil)
+}
+
+// CompareBy returns rows changed from `before` to `after`,
+// rows are identified by key columns of tables in `keys`, `id` by default
+func CompareBy(before *Snapshot, after *Snapshot, keys map[string][]string) *Diff {
+	tables := map[string][]dbutils.Result{}
+	for table, rows := range before.Tables {
+		tables[table] = rows
+	}
+	for table, rows := range after.Tables {
+		tables[table] = rows
+	}
+	diff := &Diff{}
+	for _, table := range sorted.Keys(tables) {
+		key, ok := keys[table]
+		if !ok {
+			key = []string{"id"}
+		}
+		td := compareTable(table, before.Tables[table], after.Tables[table], key)
+		if len(td.Inserted) + len(td.Updated) + len(td.Deleted) > 0 {
+			diff.Tables = append(diff.Tables, td)
+		}
+	}
+	return diff
+}
+
+func compareTable(table string, before []dbutils.Result, after []dbutils.Result, key []string) *TableDiff {
+	td := &TableDiff{Table:table}
+	// rows sharing a key are matched in order
+	old := map[string][]dbutils.Result{}
+	var oldKeys []string
+	for _, row := range before {
+		k := keyOf(row, key)
+		if _, ok := old[k]; !ok {
+			oldKeys = append(oldKeys, k)
+		}
+		old[k] = append(old[k], row)
+	}
+	for _, row := range after {
+		k := keyOf(row, key)
+		if len(old[k]) == 0 {
+			td.Inserted = append(td.Inserted, row)
+			continue
+		}
+		previous := old[k][0]
+		old[k] = old[k][1:]
+		if columns := changedColumns(previous, row); len(columns) > 0 {
+			td.Updated = append(td.Updated, &Update{Key:k, Before:previous, After:row, Columns:columns})
+		}
+	}
+	for _, k := range oldKeys {
+		td.Deleted = append(td.Deleted, old[k]...)
+	}
+	sortRows(td.Inserted, key)
+	sortRows(td.Deleted, key)
+	sort.SliceStable(td.Updated, func(i, j int) bool {
+		return lessKey(td.Updated[i].After, td.Updated[j].After, key)
+	})
+	return td
+}
+
+// keyOf identifies `row` by `key` columns, or all columns if any is missing
+func keyOf(row dbutils.Result, key []string) string {
+	var parts []string
+	for _, column := range key {
+		value, ok := row[column]
+		if !ok {
+			return formatRow(row)
+		}
+		parts = append(parts, column + "=" + formatValue(value))
+	}
+	if len(parts) == 0 {
+		return formatRow(row)
+	}
+	return strings.Join(parts, ",")
+}
+
+func sortRows(rows []dbutils.Result, key []string) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		return lessKey(rows[i], rows[j], key)
+	})
+}
+
+// lessKey orders rows by `key` columns, numbers by value so id=2 goes before id=10
+func lessKey(a dbutils.Result, b dbutils.Result, key []string) bool {
+	for _, column := range key {
+		va, okA := a[column]
+		vb, okB := b[column]
+		if !okA || !okB {
+			break
+		}
+		if fa, fb := formatValue(va), formatValue(vb); fa != fb {
+			return lessValue(fa, fb)
+		}
+	}
+	return keyOf(a, key) < keyOf(b, key)
+}
+
+// lessValue compares formatted values, numbers by value and others as text
+func lessValue(a string, b string) bool {
+	if x, err := strconv.ParseInt(a, 10, 64); err == nil {
+		if y, err := strconv.ParseInt(b, 10, 64); err == nil {
+			return x < y
+		}
+	}
+	if x, err := strconv.ParseFloat(a, 64); err == nil {
+		if y, err := strconv.ParseFloat(b, 64); err == nil {
+			return x < y
+		}
+	}
+	return a < b
+}
+
+func changedColumns(before dbutils.Result, after dbutils.Result) []string {
+	columns := map[string]bool{}
+	for column := range before {
+		columns[column] = true
+	}
+	for column := range after {
+		columns[column] = true
+	}
+	var changed []string
+	for column := range columns {
+		_, inBefore := before[column]
+		_, inAfter := after[column]
+		if inBefore != inAfter || formatValue(before[column]) != formatValue(after[column]) {
+			changed = append(changed, column)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// formatRow renders `row` like `{id: 1, name: "Python"}`
+func formatRow(row dbutils.Result) string {
+	columns := sorted.Keys(row)
+	parts := make([]string, len(columns))
+	for i, column := range columns {
+		parts[i] = column + ": " + formatValue(row[column])
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+// formatValue renders a driver value, text of drivers returning bytes or strings is the same.
+// Text of a number in its shortest form renders as the number, since MySQL returns
+// numbers as text: `1` of SQLite and `[]byte("1")` of MySQL both render `1`.
+// Text of other forms is kept, so a DECIMAL `9.90` of MySQL and a REAL `9.9` of SQLite
+// differ, golden files of such columns are per driver
+func formatValue(value interface{}) string {
+	switch tp := value.(type) {
+	case nil:
+		return "NULL"
+	case []byte:
+		return formatText(string(tp))
+	case string:
+		return formatText(tp)
+	case time.Time:
+		return tp.UTC().Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(tp)
+	}
+}
+
+// formatText renders text, numbers in their shortest form are not quoted
+func formatText(text string) string {
+	if i, err := strconv.ParseInt(text, 10, 64); err == nil && strconv.FormatInt(i, 10) == text {
+		return text
+	}
+	if f, err := strconv.ParseFloat(text, 64); err == nil && strconv.FormatFloat(f, 'g', -1, 64) == text {
+		return text
+	}
+	return strconv.Quote(text)
+}
+
+// Capture runs `fn` and returns rows of `tables` it changes
+//
+// Example:
+//   diff := snapshot.Capture(t, tx, []string{"t_book"}, func() {
+//       table.Update(dbutils.FieldMap{"name": "Go"}, dbutils.WhereMap{"id": Q.EQ(2)})
+//   })
+//   snapshot.AssertGolden(t, "testdata/update.golden", diff)
+func Capture(t testing.TB, tx *sqlx.Tx, tables []string, fn func()) *Diff {
+	t.Helper()
+	before, err := Take(tx, tables...)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	fn()
+	after, err := Take(tx, tables...)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	return Compare(before, after)
+}
+
+// AssertNoChanges fails `t` if `diff` is not empty
+func AssertNoChanges(t testing.TB, diff *Diff) {
+	t.Helper()
+	if !diff.Empty() {
+		t.Fatalf("expect no changes, got:\n%s", diff)
+	}
+}
+
+// AssertRowExists fails `t` if no row of `table` matches `where`
+func AssertRowExists(t testing.TB, tx *sqlx.Tx, table string, where ...dbutils.WhereMap) {
+	t.Helper()
+	if n := count(t, tx, table, where); n == 0 {
+		t.Fatalf("expect a row of %s matches %v, got none", table, where)
+	}
+}
+
+// AssertNoRow fails `t` if any row of `table` matches `where`
+func AssertNoRow(t testing.TB, tx *sqlx.Tx, table string, where ...dbutils.WhereMap) {
+	t.Helper()
+	if n := count(t, tx, table, where); n != 0 {
+		t.Fatalf("expect no row of %s matches %v, got %d", table, where, n)
+	}
+}
+
+func count(t testing.TB, tx *sqlx.Tx, table string, where []dbutils.WhereMap) int {
+	t.Helper()
+	rows, err := use(tx, table).Query(nil, where...)
+	if err != nil {
+		t.Fatalf("query %s: %v", table, err)
+	}
+	defer rows.Close()
+	n := 0
+	for rows.Next() {
+		n++
+	}
+	if err = rows.Err(); err != nil {
+		t.Fatalf("query %s: %v", table, err)
+	}
+	return n
+}
+
+// AssertGolden fails `t` if `actual` (a `Diff`, `Snapshot` or anything printed by `%v`)
+// differs from the golden file `path`,
+// the file is written instead if environment variable `DBUTILS_UPDATE_GOLDEN` is set
+func AssertGolden(t testing.TB, path string, actual interface{}) {
+	t.Helper()
+	text := fmt.Sprint(actual)
+	if os.Getenv(UpdateEnv) != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("%v", err)
+		}
+		if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+			t.Fatalf("%v", err)
+		}
+		return
+	}
+	golden, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (set %s=1 to write it)", err, UpdateEnv)
+	}
+	if string(golden) != text {
+		t.Fatalf("differs from golden file %s:\n--- expected\n%s\n--- actual\n%s", path, golden, text)
+	}
+}
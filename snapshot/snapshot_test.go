@@ -0,0 +1,103 @@
+package snapshot
+
+import (
+	"testing"
+
+	"github.com/argpass/dbutils"
+	"github.com/argpass/dbutils/Q"
+	"github.com/argpass/dbutils/dbtest"
+	"github.com/jmoiron/sqlx"
+)
+
+var schema = dbtest.Schema{
+	Create: map[Q.Dialect]string{
+		Q.SQLite: `CREATE TABLE t_book(id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL, tag INTEGER);
+		INSERT INTO t_book (name) VALUES ('Python'), ('Golang'), ('Ruby');
+		CREATE TABLE t_tag(name TEXT NOT NULL);
+		INSERT INTO t_tag (name) VALUES ('a'), ('a'), ('b')`,
+	},
+}
+
+func TestCapture(t *testing.T) {
+	dbtest.Run(t, schema, func(t *testing.T, tx *sqlx.Tx) {
+		table := dbutils.NewSimpleTable(tx, "t_book")
+		diff := Capture(t, tx, []string{"t_book"}, func() {
+			if _, err := table.Insert(dbutils.FieldMap{"name":"Java", "tag":1}); err != nil {
+				t.Fatalf("[insert] err:%v", err)
+			}
+			if _, err := table.Update(dbutils.FieldMap{"name":"Go"}, dbutils.WhereMap{"id":Q.EQ(2)}); err != nil {
+				t.Fatalf("[update] err:%v", err)
+			}
+			if _, err := table.Delete(dbutils.WhereMap{"id":Q.EQ(1)}); err != nil {
+				t.Fatalf("[delete] err:%v", err)
+			}
+		})
+		td := diff.Table("t_book")
+		if td == nil || len(td.Inserted) != 1 || len(td.Updated) != 1 || len(td.Deleted) != 1 {
+			t.Fatalf("bad diff:\n%s", diff)
+		}
+		AssertGolden(t, "testdata/capture.golden", diff)
+		AssertRowExists(t, tx, "t_book", dbutils.WhereMap{"name":Q.EQ("Go")})
+		AssertNoRow(t, tx, "t_book", dbutils.WhereMap{"name":Q.EQ("Python")})
+
+		AssertNoChanges(t, Capture(t, tx, []string{"t_book"}, func() {
+			if _, err := table.Update(dbutils.FieldMap{"name":"Go"}, dbutils.WhereMap{"id":Q.EQ(2)}); err != nil {
+				t.Fatalf("[update] err:%v", err)
+			}
+		}))
+	})
+}
+
+func TestCapture_NoID(t *testing.T) {
+	dbtest.Run(t, schema, func(t *testing.T, tx *sqlx.Tx) {
+		table := dbutils.NewSimpleTable(tx, "t_tag")
+		// copies of a row without id are counted
+		diff := Capture(t, tx, []string{"t_tag"}, func() {
+			if _, err := table.InsertMany(dbutils.FieldValuesMap{"name":{"a", "b"}}); err != nil {
+				t.Fatalf("[insert] err:%v", err)
+			}
+		})
+		if diff.String() != "t_tag:\n  + {name: \"a\"}\n  + {name: \"b\"}\n" {
+			t.Fatalf("bad diff:\n%s", diff)
+		}
+		diff = Capture(t, tx, []string{"t_tag"}, func() {
+			if _, err := table.Delete(dbutils.WhereMap{"name":Q.EQ("a")}); err != nil {
+				t.Fatalf("[delete] err:%v", err)
+			}
+		})
+		if td := diff.Table("t_tag"); td == nil || len(td.Deleted) != 3 || len(td.Inserted) != 0 {
+			t.Fatalf("expect 3 copies deleted, got:\n%s", diff)
+		}
+	})
+}
+
+func TestCompare_NumericKeys(t *testing.T) {
+	before := &Snapshot{Tables:map[string][]dbutils.Result{"t_book":{
+		{"id":int64(10), "name":"a"}, {"id":int64(2), "name":"b"},
+	}}}
+	after := &Snapshot{Tables:map[string][]dbutils.Result{"t_book":{
+		{"id":[]byte("30"), "name":"c"}, {"id":[]byte("4"), "name":"d"},
+	}}}
+	td := Compare(before, after).Table("t_book")
+	if td == nil || len(td.Inserted) != 2 || len(td.Deleted) != 2 {
+		t.Fatalf("bad diff:%+v", td)
+	}
+	if string(td.Inserted[0]["id"].([]byte)) != "4" || td.Deleted[0]["id"] != int64(2) {
+		t.Fatalf("expect rows sorted by numeric id, got %v, %v", td.Inserted, td.Deleted)
+	}
+}
+
+func TestFormatValue(t *testing.T) {
+	// MySQL returns numbers as text
+	for _, c := range []struct {
+		value    interface{}
+		expected string
+	}{
+		{int64(1), "1"}, {[]byte("1"), "1"}, {"-12", "-12"}, {[]byte("1.5"), "1.5"}, {1.5, "1.5"},
+		{[]byte("9.90"), `"9.90"`}, {"007", `"007"`}, {"Go", `"Go"`}, {nil, "NULL"},
+	} {
+		if actual := formatValue(c.value); actual != c.expected {
+			t.Fatalf("expect %s of %#v, got %s", c.expected, c.value, actual)
+		}
+	}
+}
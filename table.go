@@ -1,13 +1,25 @@
 package dbutils
 
 import (
+	"context"
 	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/reflectx"
 	"errors"
 	"database/sql"
+	"database/sql/driver"
+	"reflect"
 	"github.com/argpass/dbutils/Q"
 	"github.com/argpass/dbutils/evt"
+	"github.com/argpass/dbutils/trace"
 	"fmt"
 	"golang.org/x/tools/container/intsets"
+	"math/big"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
 // NO_INSERT_FIELDS is exception when trying to build insert sql with no insert fields
@@ -16,10 +28,13 @@ var NO_INSERT_FIELDS = errors.New("no insert fields")
 // NO_UPDATE_FIELDS is exception when trying to build update sql with no insert fields
 var NO_UPDATE_FIELDS = errors.New("no update fields")
 
+// NO_TX is the error of running statements by a table without transaction
+var NO_TX = errors.New("no transaction")
+
 // Result is a map type holding data of a row
 // I will serve some methods to get data easily
-// all integer in db will be returned as int64
-// todo: the converting rule of other db(psql, sqlite) ?
+// all integer in db will be returned as int64,
+// text of mysql is []byte while sqlite drivers return string
 type Result map[string] interface{}
 
 func (p Result) get(name string) (value interface{}, err error)  {
@@ -53,10 +68,7 @@ func (p Result) GetBool(name string) (value bool, err error)  {
 		if i != 0 && i != 1 {
 			err = fmt.Errorf("no bool `%s`", name)
 		}else{
-			if i == 0 {
-				value = false
-			}
-			value = true
+			value = i == 1
 		}
 	default:
 		err = fmt.Errorf("no bool `%s`", name)
@@ -108,6 +120,7 @@ func (p Result) GetString(name string) (value string, err error)  {
 }
 
 // GetBytes picks []bytes value of `name`
+// it also converts string value (sqlite drivers return text as string)
 func (p Result) GetBytes(name string) (value []byte, err error)  {
 	v, ok := p[name]
 	if !ok {
@@ -117,15 +130,427 @@ func (p Result) GetBytes(name string) (value []byte, err error)  {
 	switch tp:=v.(type) {
 	case []byte:
 		value = tp
+	case string:
+		value = []byte(tp)
 	default:
 		err = fmt.Errorf("no []byte %s", name)
 	}
 	return value, err
 }
 
+// text returns the text of []byte or string value `v`
+func text(v interface{}) (string, bool) {
+	switch tp := v.(type) {
+	case []byte:
+		return string(tp), true
+	case string:
+		return tp, true
+	}
+	return "", false
+}
+
+// GetFloat64 picks float64 value of `name`
+// it converts integers (uint64 of large unsigned columns may lose precision) and text (DECIMAL and FLOAT of mysql are returned as []byte)
+func (p Result) GetFloat64(name string) (value float64, err error)  {
+	var v interface{}
+	v, err = p.get(name)
+	if err != nil {
+		return value, err
+	}
+	switch tp:=v.(type) {
+	case float64:
+		value = tp
+	case float32:
+		value = float64(tp)
+	case int64:
+		value = float64(tp)
+	case uint64:
+		value = float64(tp)
+	default:
+		s, ok := text(v)
+		if !ok {
+			return value, fmt.Errorf("no float64 `%s`, can't convert %T", name, v)
+		}
+		value, err = strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			err = fmt.Errorf("no float64 `%s`, %v", name, err)
+		}
+	}
+	return value, err
+}
+
+// GetUint64 picks uint64 value of `name`
+// it converts non negative int64 and text
+func (p Result) GetUint64(name string) (value uint64, err error)  {
+	var v interface{}
+	v, err = p.get(name)
+	if err != nil {
+		return value, err
+	}
+	switch tp:=v.(type) {
+	case uint64:
+		value = tp
+	case int64:
+		if tp < 0 {
+			return value, fmt.Errorf("no uint64 `%s`, %d is negative", name, tp)
+		}
+		value = uint64(tp)
+	default:
+		s, ok := text(v)
+		if !ok {
+			return value, fmt.Errorf("no uint64 `%s`, can't convert %T", name, v)
+		}
+		value, err = strconv.ParseUint(strings.TrimSpace(s), 10, 64)
+		if err != nil {
+			err = fmt.Errorf("no uint64 `%s`, %v", name, err)
+		}
+	}
+	return value, err
+}
+
+// timeLayouts are formats of time text returned by drivers
+var timeLayouts = []string{
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999 -0700 MST",
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02",
+}
+
+// GetTime picks time value of `name`
+// mysql returns time.Time with `parseTime=true` in the DSN, and text otherwise,
+// text without time zone is parsed in UTC
+// which is the default `loc` of mysql
+func (p Result) GetTime(name string) (value time.Time, err error)  {
+	var v interface{}
+	v, err = p.get(name)
+	if err != nil {
+		return value, err
+	}
+	if tp, ok := v.(time.Time); ok {
+		return tp, nil
+	}
+	s, ok := text(v)
+	if !ok {
+		return value, fmt.Errorf("no time `%s`, can't convert %T", name, v)
+	}
+	s = strings.TrimSpace(s)
+	for _, layout := range timeLayouts {
+		if value, err = time.Parse(layout, s); err == nil {
+			return value, nil
+		}
+	}
+	return value, fmt.Errorf("no time `%s`, unknown format %q", name, s)
+}
+
+// Decimal is an exact decimal number like `-12.340`
+type Decimal string
+
+var decimalPattern = regexp.MustCompile(`^[-+]?(\d+(\.\d*)?|\.\d+)([eE][-+]?\d+)?$`)
+
+// Rat converts the decimal to `big.Rat`
+func (d Decimal) Rat() *big.Rat {
+	r, ok := new(big.Rat).SetString(string(d))
+	if !ok {
+		return nil
+	}
+	return r
+}
+
+func (d Decimal) String() string {
+	return string(d)
+}
+
+// GetDecimal picks exact decimal value of `name`
+// it keeps text (DECIMAL of mysql and NUMERIC of postgres) as it is,
+// integers are converted and floats are formatted in the shortest form that round-trips
+func (p Result) GetDecimal(name string) (value Decimal, err error)  {
+	var v interface{}
+	v, err = p.get(name)
+	if err != nil {
+		return value, err
+	}
+	switch tp:=v.(type) {
+	case int64:
+		value = Decimal(strconv.FormatInt(tp, 10))
+	case uint64:
+		value = Decimal(strconv.FormatUint(tp, 10))
+	case float64:
+		value = Decimal(strconv.FormatFloat(tp, 'f', -1, 64))
+	default:
+		s, ok := text(v)
+		if !ok {
+			return value, fmt.Errorf("no decimal `%s`, can't convert %T", name, v)
+		}
+		s = strings.TrimSpace(s)
+		if !decimalPattern.MatchString(s) {
+			return value, fmt.Errorf("no decimal `%s`, bad number %q", name, s)
+		}
+		value = Decimal(s)
+	}
+	return value, err
+}
+
+// GetDuration picks duration value of `name`
+// it converts TIME text of mysql like `-838:59:59.5`, interval text of postgres
+// like `2 days`, `1 day 02:00:00` or `-1 days +02:00:00` (days and clock signed apart),
+// go durations like `1h30m`, and a bare int64 is taken as seconds.
+// Intervals of months or years have no fixed duration and fail
+func (p Result) GetDuration(name string) (value time.Duration, err error)  {
+	var v interface{}
+	v, err = p.get(name)
+	if err != nil {
+		return value, err
+	}
+	if tp, ok := v.(int64); ok {
+		return time.Duration(tp) * time.Second, nil
+	}
+	s, ok := text(v)
+	if !ok {
+		return value, fmt.Errorf("no duration `%s`, can't convert %T", name, v)
+	}
+	value, err = parseDuration(strings.TrimSpace(s))
+	if err != nil {
+		err = fmt.Errorf("no duration `%s`, %v", name, err)
+	}
+	return value, err
+}
+
+// clockPattern matches `[[+-]N day[s]][ ][[+-]HH:MM:SS[.frac]]`
+var clockPattern = regexp.MustCompile(`^(?:([+-]?\d+) days?)? ?(?:([+-])?(\d+):(\d{2}):(\d{2})(\.\d+)?)?$`)
+
+func parseDuration(s string) (time.Duration, error) {
+	m := clockPattern.FindStringSubmatch(s)
+	if m == nil || (m[1] == "" && m[3] == "") {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, fmt.Errorf("unknown format %q", s)
+		}
+		return d, nil
+	}
+	var days, clock time.Duration
+	if m[1] != "" {
+		n, _ := strconv.ParseInt(m[1], 10, 64)
+		days = time.Duration(n) * 24 * time.Hour
+	}
+	if m[3] != "" {
+		hours, _ := strconv.ParseInt(m[3], 10, 64)
+		minutes, _ := strconv.ParseInt(m[4], 10, 64)
+		seconds, _ := strconv.ParseInt(m[5], 10, 64)
+		clock = time.Duration(hours) * time.Hour + time.Duration(minutes) * time.Minute +
+			time.Duration(seconds) * time.Second
+		if m[6] != "" {
+			frac, _ := strconv.ParseFloat("0" + m[6], 64)
+			clock += time.Duration(frac * float64(time.Second))
+		}
+		if m[2] == "-" {
+			clock = -clock
+		}
+	}
+	return days + clock, nil
+}
+
+// execution is a statement being executed, `finish` ends its span
+// and sends its event once the statement returns and `rowsDone`
+// sends the `RowsEvent` of a select once its rows are consumed
+type execution struct {
+	ctx   context.Context
+	event *SQLEvent
+	span  trace.Span
+	bus   *evt.Bus
+	// capture appends returned rows to the rows event
+	capture bool
+	// rows is the rows event of a select being consumed
+	rows *RowsEvent
+}
+
+// captureRow appends a returned row to the rows event
+func (x *execution) captureRow(columns []string, values []interface{}) {
+	event := x.rows.Event
+	if event.Columns == nil {
+		event.Columns = columns
+	}
+	event.Values = append(event.Values, values)
+}
+
+// scannedValue is the value scanned into `dest`
+func scannedValue(dest interface{}) interface{} {
+	if valuer, ok := dest.(driver.Valuer); ok {
+		value, _ := valuer.Value()
+		return value
+	}
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return dest
+	}
+	switch value := v.Elem().Interface().(type) {
+	case sql.RawBytes:
+		return append([]byte(nil), value...)
+	case []byte:
+		return append([]byte(nil), value...)
+	default:
+		return value
+	}
+}
+
+// finish completes the event with `err`, ends the span and sends the event,
+// `pending` tells the rows of a select follow in a `RowsEvent`
+func (x *execution) finish(err error, pending bool) {
+	event := x.event
+	event.Duration = time.Since(event.Start)
+	event.Error = err
+	event.RowsPending = pending
+	if pending {
+		completed := *event
+		x.rows = &RowsEvent{Event:&completed}
+	}
+	// the span ends once the statement returns, even if rows are never consumed
+	if x.span != nil {
+		if !pending {
+			x.span.SetAttribute(trace.DBRows, event.Rows)
+		}
+		if err != nil {
+			x.span.RecordError(err)
+		}
+		x.span.End()
+	}
+	x.bus.SynSend(event)
+}
+
+// rowsDone completes the rows event with `err` of reading rows and sends it
+func (x *execution) rowsDone(err error) {
+	rows := x.rows
+	if rows == nil {
+		return
+	}
+	x.rows = nil
+	rows.Duration = time.Since(rows.Event.Start)
+	rows.Error = err
+	x.bus.SynSend(rows)
+}
+
 // Row is wrapper of `sqlx.Row`
+// the `RowsEvent` of `SimpleTable.Get` is sent once the row is scanned,
+// never if the row is not scanned
 type Row struct {
 	*sqlx.Row
+	exec *execution
+}
+
+// done sends the rows event of the row
+func (p *Row) done(err error) {
+	if p.exec == nil {
+		return
+	}
+	x := p.exec
+	p.exec = nil
+	if err == nil {
+		x.rows.Event.Rows = 1
+	}else if err == sql.ErrNoRows {
+		err = nil
+	}
+	x.rowsDone(err)
+}
+
+// capturing tells if the row is captured in the event
+func (p *Row) capturing() bool {
+	return p.exec != nil && p.exec.capture
+}
+
+// columns returns columns of the row before it is scanned
+func (p *Row) columns() []string {
+	if p.Row.Err() != nil {
+		return nil
+	}
+	columns, _ := p.Row.Columns()
+	return columns
+}
+
+// Scan wraps `sqlx.Row.Scan` to send the rows event
+func (p *Row) Scan(dest ...interface{}) (err error) {
+	var columns []string
+	if p.capturing() {
+		columns = p.columns()
+	}
+	err = p.Row.Scan(dest...)
+	if err == nil && columns != nil {
+		values := make([]interface{}, len(dest))
+		for i := range dest {
+			values[i] = scannedValue(dest[i])
+		}
+		p.exec.captureRow(columns, values)
+	}
+	p.done(err)
+	return err
+}
+
+// MapScan wraps `sqlx.Row.MapScan` to send the rows event
+func (p *Row) MapScan(dest map[string]interface{}) (err error) {
+	var columns []string
+	if p.capturing() {
+		columns = p.columns()
+	}
+	err = p.Row.MapScan(dest)
+	if err == nil && columns != nil {
+		values := make([]interface{}, len(columns))
+		for i, column := range columns {
+			values[i] = dest[column]
+		}
+		p.exec.captureRow(columns, values)
+	}
+	p.done(err)
+	return err
+}
+
+// SliceScan wraps `sqlx.Row.SliceScan` to send the rows event
+func (p *Row) SliceScan() (values []interface{}, err error) {
+	var columns []string
+	if p.capturing() {
+		columns = p.columns()
+	}
+	values, err = p.Row.SliceScan()
+	if err == nil && columns != nil {
+		p.exec.captureRow(columns, values)
+	}
+	p.done(err)
+	return values, err
+}
+
+// StructScan wraps `sqlx.Row.StructScan` to send the rows event
+func (p *Row) StructScan(dest interface{}) (err error) {
+	if p.capturing() {
+		// scan fields one by one to capture them
+		if fields, ok := p.fields(dest); ok {
+			return p.Scan(fields...)
+		}
+	}
+	err = p.Row.StructScan(dest)
+	p.done(err)
+	return err
+}
+
+// fields returns pointers to fields of struct `dest` mapped by columns,
+// false if any column is not mapped
+func (p *Row) fields(dest interface{}) (fields []interface{}, ok bool) {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct || p.Row.Mapper == nil {
+		return nil, false
+	}
+	if _, scanner := dest.(sql.Scanner); scanner {
+		return nil, false
+	}
+	columns := p.columns()
+	if columns == nil {
+		return nil, false
+	}
+	for _, traversal := range p.Row.Mapper.TraversalsByName(v.Type(), columns) {
+		if len(traversal) == 0 {
+			return nil, false
+		}
+		fields = append(fields, reflectx.FieldByIndexes(v.Elem(), traversal).Addr().Interface())
+	}
+	return fields, true
 }
 
 // GetResult scans current row as `Result`
@@ -137,8 +562,59 @@ func (p *Row) GetResult() (result Result, err error){
 }
 
 // Rows is wrapper of `sqlx.Rows`
+// it counts rows and sends the `RowsEvent` of `SimpleTable.Query`
+// when all rows are read or it is closed, never if it is abandoned
 type Rows struct {
 	*sqlx.Rows
+	exec *execution
+}
+
+// done sends the rows event of the rows
+func (p *Rows) done(err error) {
+	if p.exec == nil {
+		return
+	}
+	x := p.exec
+	p.exec = nil
+	x.rowsDone(err)
+}
+
+// Next wraps `sqlx.Rows.Next` to count rows
+func (p *Rows) Next() bool {
+	if p.Rows.Next() {
+		if p.exec != nil {
+			p.exec.rows.Event.Rows++
+			if p.exec.capture {
+				p.capture()
+			}
+		}
+		return true
+	}
+	p.done(p.Rows.Err())
+	return false
+}
+
+// capture appends the current row to the rows event,
+// rows can be scanned again by the caller
+func (p *Rows) capture() {
+	columns, err := p.Rows.Columns()
+	if err != nil {
+		return
+	}
+	values, err := p.Rows.SliceScan()
+	if err == nil {
+		p.exec.captureRow(columns, values)
+	}
+}
+
+// Close wraps `sqlx.Rows.Close` to send the rows event
+func (p *Rows) Close() (err error) {
+	err = p.Rows.Close()
+	if err == nil {
+		err = p.Rows.Err()
+	}
+	p.done(err)
+	return err
 }
 
 // GetResult scans current row as `Result`
@@ -149,33 +625,259 @@ func (p *Rows) GetResult() (result Result, err error){
 	return result, err
 }
 
+// Op is the kind of a sql statement
+type Op string
+
+const (
+	OpInsert Op = "insert"
+	OpUpdate Op = "update"
+	OpDelete Op = "delete"
+	OpSelect Op = "select"
+	// OpOther is any other statement run by `SimpleTable.Exec`
+	OpOther  Op = "other"
+)
+
+// opOf guesses the kind of `query` by its first keyword
+func opOf(query string) Op {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return OpOther
+	}
+	switch strings.ToUpper(fields[0]) {
+	case "INSERT", "REPLACE":
+		return OpInsert
+	case "UPDATE":
+		return OpUpdate
+	case "DELETE":
+		return OpDelete
+	case "SELECT", "WITH":
+		return OpSelect
+	}
+	return OpOther
+}
+
 // SQLEvent ought to be triggered every sql executed
 type SQLEvent struct {
 	Query string
+	// Args are the args with values of sensitive columns replaced by `REDACTED`, see `RawArgs`
 	Args []interface{}
 	Result sql.Result
 	Error error
+	// Start is the time the statement is sent
+	Start time.Time
+	// Duration is the time the statement takes to return,
+	// reading rows of a select is timed by its `RowsEvent`
+	Duration time.Duration
+	// Rows is the number of rows affected by insert/update/delete,
+	// rows returned by a select are counted by its `RowsEvent`
+	Rows int64
+	// Table is the name of the table operated
+	Table string
+	Op Op
+	// Method is the `SimpleTable` method running the statement
+	Method string
+	// TxID is the id of the `Tx` running the statement, 0 if not in a `Tx`
+	TxID uint64
+	// Fingerprint is the normalized `Query`, see `FingerprintFor`
+	Fingerprint string
+	// Context is the context the table runs the statement with, see `SimpleTable.WithContext`
+	Context context.Context
+	// Aborted tells the statement is aborted by hooks (or has no `tx`) and never sent to the database
+	Aborted bool
+	// Caller are program counters of the call stack running the statement,
+	// captured only if a hook sets `Statement.CaptureCaller`, see `runtime.CallersFrames`
+	Caller []uintptr
+	// RowsPending tells the rows of the select follow in a `RowsEvent`
+	RowsPending bool
+	// Columns and Values are the rows returned by a select, they are filled
+	// in the `RowsEvent` only if a hook sets `Statement.CaptureRows`
+	Columns []string
+	Values [][]interface{}
+	// rawArgs are `Args` before redaction
+	rawArgs []interface{}
+}
+
+// RawArgs returns the args sent to the database, values of sensitive columns are not redacted.
+// Keep them away from logs, they are for consumers running the statement again like EXPLAIN
+func (e *SQLEvent) RawArgs() []interface{} {
+	if e.rawArgs == nil {
+		return e.Args
+	}
+	return e.rawArgs
+}
+
+// RowsEvent is triggered when the rows of a select are consumed,
+// that is the row of `SimpleTable.Get` is scanned or the rows of `SimpleTable.Query`
+// are read to the end or closed. Rows never consumed trigger no `RowsEvent`
+type RowsEvent struct {
+	// Event is a copy of the `SQLEvent` of the select
+	// completed with `Rows`, `Columns` and `Values`
+	Event    *SQLEvent
+	// Duration is the time from sending the statement to consuming the rows
+	Duration time.Duration
+	// Error is the error of reading rows
+	Error    error
 }
 
 // SimpleTable is a tool to operate db table easily
 type SimpleTable struct {
 	tx       *sqlx.Tx
 	table    string
+	dialect  Q.Dialect
+	hooks    []Hook
+	bus      *evt.Bus
+	txn      *Tx
+	ctx      context.Context
+	tracer   trace.Tracer
+	// sensitive columns in lower case
+	sensitive map[string]bool
 }
 
 // NewSimpleTable create new instance of `SimpleTable`
+// the sql dialect is picked by the driver name of `tx`, MySQL if `tx` is nil.
+// A table without `tx` only builds SQL, its statements fail with `NO_TX`
 func NewSimpleTable(tx *sqlx.Tx, tableName string) (*SimpleTable) {
-	p := &SimpleTable{tx:tx, table:tableName}
+	p := &SimpleTable{tx:tx, table:tableName, dialect:Q.MySQL,
+		bus:evt.Default(), ctx:context.Background()}
+	if tx != nil {
+		p.dialect = Q.DialectOf(tx.DriverName())
+	}
+	return p
+}
+
+// UseBus sends sql events of the table to `bus` instead of the default bus
+func (p *SimpleTable) UseBus(bus *evt.Bus) *SimpleTable {
+	p.bus = bus
 	return p
 }
 
+// UseTracer traces every statement of the table with `tracer`
+func (p *SimpleTable) UseTracer(tracer trace.Tracer) *SimpleTable {
+	p.tracer = tracer
+	return p
+}
+
+// WithContext returns a copy of the table running statements with `ctx`,
+// spans of statements are children of the span in `ctx`
+func (p *SimpleTable) WithContext(ctx context.Context) *SimpleTable {
+	table := *p
+	table.ctx = ctx
+	table.hooks = p.hooks[:len(p.hooks):len(p.hooks)]
+	return &table
+}
+
+// Dialect returns the sql dialect queries are rendered for
+func (p *SimpleTable) Dialect() Q.Dialect {
+	return p.dialect
+}
+
+// Before adds hooks running around statements of the table,
+// they run after the global hooks added by `dbutils.Before`
+func (p *SimpleTable) Before(hooks ...Hook) *SimpleTable {
+	p.hooks = append(p.hooks, hooks...)
+	return p
+}
+
+// newEvent builds the sql event of a statement starting now
+// args of sensitive columns are redacted
+func (p *SimpleTable) newEvent(stmt *Statement) *SQLEvent {
+	raw, args := untag(stmt.Args)
+	return &SQLEvent{Query:stmt.Query, Args:args, rawArgs:raw, Start:time.Now(),
+		Table:stmt.Table, Op:stmt.Op, Method:stmt.Method, TxID:stmt.TxID,
+		Fingerprint:FingerprintFor(p.dialect, stmt.Query), Context:p.ctx}
+}
+
+// start starts the execution of the statement and its span
+func (p *SimpleTable) start(stmt *Statement) *execution {
+	x := &execution{ctx:p.ctx, bus:p.bus, capture:stmt.CaptureRows}
+	if p.tracer != nil {
+		x.ctx, x.span = p.tracer.Start(p.ctx, string(stmt.Op) + " " + stmt.Table)
+		x.span.SetAttribute(trace.DBSystem, dbSystem(p.dialect))
+		x.span.SetAttribute(trace.DBStatement, stmt.Query)
+		x.span.SetAttribute(trace.DBOperation, strings.ToUpper(string(stmt.Op)))
+		x.span.SetAttribute(trace.DBTable, stmt.Table)
+		if stmt.TxID != 0 {
+			x.span.SetAttribute(trace.DBTxID, stmt.TxID)
+		}
+	}
+	x.event = p.newEvent(stmt)
+	if stmt.CaptureCaller {
+		x.event.Caller = callers()
+	}
+	return x
+}
+
+// callers returns program counters of the call stack running a statement
+func callers() []uintptr {
+	pcs := make([]uintptr, 64)
+	// skip runtime.Callers, callers and start
+	n := runtime.Callers(3, pcs)
+	return pcs[:n]
+}
+
+// dbSystem is the OpenTelemetry `db.system` of `dialect`
+func dbSystem(dialect Q.Dialect) string {
+	if dialect == Q.Postgres {
+		return "postgresql"
+	}
+	return string(dialect)
+}
+
+// run passes the statement through hooks and calls `fn` to execute it
+// the event of a statement aborted by hooks (or for no `tx`) is sent with the error.
+// `cols` returns the column of every arg, it is called only if columns may be redacted
+func (p *SimpleTable) run(op Op, method string, query string, args []interface{},
+		cols func() []string, fn func(stmt *Statement, x *execution) error) error {
+	if cols != nil && p.redacting() {
+		args = p.tag(args, cols())
+	}
+	stmt := &Statement{Query:query, Args:args, Table:p.table, Op:op, Method:method}
+	if p.txn != nil {
+		stmt.TxID = p.txn.ID
+	}
+	executed := false
+	err := runHooks(globalHooks.all(p.hooks), stmt, func(stmt *Statement) error {
+		if p.tx == nil {
+			return NO_TX
+		}
+		executed = true
+		if p.txn != nil {
+			atomic.AddInt64(&p.txn.statements, 1)
+		}
+		stmt.Query = p.tx.Rebind(stmt.Query)
+		x := p.start(stmt)
+		stmt.Args = x.event.rawArgs
+		return fn(stmt, x)
+	})
+	if !executed {
+		event := p.newEvent(stmt)
+		event.Error = err
+		event.Aborted = true
+		p.bus.SynSend(event)
+	}
+	return err
+}
+
 // Exec wraps `p.tx.Exec` to handle callback func
-// I can print logs or do something else with callback func
+// I can print logs or do something else with callback func.
+// Its args are never redacted, see `RedactColumns`
 func (p *SimpleTable) Exec(query string, args...interface{}) (result sql.Result, err error) {
-	result, err = p.tx.Exec(query, args...)
-	// build sql event and send to subscribers
-	event := &SQLEvent{Query:query, Args:args, Result:result, Error:err}
-	evt.SynSend(event)
+	return p.exec(opOf(query), "Exec", query, args, nil)
+}
+
+// exec runs the statement and sends the sql event
+func (p *SimpleTable) exec(op Op, method string, query string, args []interface{},
+		cols func() []string) (result sql.Result, err error) {
+	err = p.run(op, method, query, args, cols, func(stmt *Statement, x *execution) error {
+		result, err = p.tx.ExecContext(x.ctx, stmt.Query, stmt.Args...)
+		// build sql event and send to subscribers
+		x.event.Result = result
+		if err == nil {
+			x.event.Rows, _ = result.RowsAffected()
+		}
+		x.finish(err, false)
+		return err
+	})
 	return result, err
 }
 
@@ -189,7 +891,9 @@ func (p *SimpleTable) Insert(fieldsMap FieldMap) (id int64, err error) {
 	if err != nil {
 		return id, err
 	}
-	result, err = p.Exec(query, args...)
+	result, err = p.exec(OpInsert, "Insert", query, args, func() []string {
+		return insertColumns(fieldsMap)
+	})
 	if err != nil {
 		return id, err
 	}
@@ -206,7 +910,9 @@ func (p *SimpleTable) InsertMany(valuesMap FieldValuesMap) (lastID int64, err er
 	if err != nil {
 		return lastID, err
 	}
-	result, err = p.Exec(query, args...)
+	result, err = p.exec(OpInsert, "InsertMany", query, args, func() []string {
+		return insertManyColumns(valuesMap)
+	})
 	if err != nil {
 		return lastID, err
 	}
@@ -218,11 +924,15 @@ func (p *SimpleTable) Update(fieldsMap FieldMap, where...WhereMap) (affected int
 	var query string
 	var result sql.Result
 	var args []interface{}
-	var whereMap = WhereMap{}
-	whereMap.Merge(where...)
+	whereMap := p.merge(where)
 
-	query, args, err = BuildUpdateSQL(p.table, fieldsMap, whereMap)
-	result, err = p.Exec(query, args...)
+	query, args, err = BuildUpdateSQLFor(p.dialect, p.table, fieldsMap, whereMap)
+	if err != nil {
+		return affected, err
+	}
+	result, err = p.exec(OpUpdate, "Update", query, args, func() []string {
+		return updateColumns(p.dialect, fieldsMap, whereMap)
+	})
 	if err != nil {
 		return affected, err
 	}
@@ -234,11 +944,13 @@ func (p *SimpleTable) Delete(where...WhereMap) (affected int64, err error)  {
 	var query string
 	var result sql.Result
 	var args []interface{}
-	var whereMap = WhereMap{}
-	whereMap.Merge(where...)
+	whereMap := p.merge(where)
 
-	query, args = BuildDeleteSQL(p.table, whereMap)
-	result, err = p.Exec(query, args...)
+	query, args = BuildDeleteSQLFor(p.dialect, p.table, whereMap)
+	result, err = p.exec(OpDelete, "Delete", query, args, func() []string {
+		cols, _ := whereColumns(p.dialect, nil, nil, whereMap)
+		return cols
+	})
 	if err != nil {
 		return affected, err
 	}
@@ -259,13 +971,21 @@ func (p *SimpleTable) Delete(where...WhereMap) (affected int64, err error)  {
 //   row, err = Query(nil, WhereMap{"age": Q.GTE(10)})
 //
 func (p *SimpleTable) Get(fieldNames []string, where ...WhereMap) (row *Row, err error) {
-	var whereMap = WhereMap{}
-	whereMap.Merge(where...)
-	query, args := BuildQuerySQL(p.table, whereMap, fieldNames, Q.Limit{0, 1})
-	row = &Row{(p.tx.QueryRowx(query, args...))}
-	// send sql event
-	event := &SQLEvent{Query:query, Args:args, Result:nil, Error:err}
-	evt.SynSend(event)
+	whereMap := p.merge(where)
+	query, args := BuildQuerySQLFor(p.dialect, p.table, whereMap, fieldNames, Q.Limit{0, 1})
+	cols := func() []string {
+		return queryColumns(p.dialect, whereMap, nil)
+	}
+	err = p.run(OpSelect, "Get", query, args, cols, func(stmt *Statement, x *execution) error {
+		row = &Row{Row:p.tx.QueryRowxContext(x.ctx, stmt.Query, stmt.Args...)}
+		// the rows event follows once the row is scanned
+		err := row.Err()
+		x.finish(err, err == nil)
+		if err == nil {
+			row.exec = x
+		}
+		return err
+	})
 	return row, err
 }
 
@@ -283,18 +1003,56 @@ func (p *SimpleTable) Get(fieldNames []string, where ...WhereMap) (row *Row, err
 //   rows, err = Query(nil, WhereMap{"age": Q.GTE(10)})
 //
 func (p *SimpleTable) Query(fieldNames []string, where ...WhereMap) (rows *Rows, err error)  {
-	var whereMap = WhereMap{}
-	whereMap.Merge(where...)
-	query, args := BuildQuerySQL(p.table, whereMap, fieldNames, Q.Limit{})
-	var rs *sqlx.Rows
-	rs, err = p.tx.Queryx(query, args...)
-	rows = &Rows{rs}
-	// send sql event
-	event := &SQLEvent{Query:query, Args:args, Result:nil, Error:err}
-	evt.SynSend(event)
+	return p.query("Query", nil, fieldNames, where)
+}
+
+// QueryWith queries rows match `where` with options
+// selecting extra columns and sorting rows
+//
+// Example:
+//
+//   // select *, match(...) against(...) as score from t_table
+//   // where match(...) against(...) order by score desc
+//   opts := []Q.Option{
+//       Q.MatchScore("score", "title", "golang", Q.NaturalMode),
+//       Q.OrderBy{"-score"},
+//   }
+//   rows, err = QueryWith(opts, nil, WhereMap{"title": Q.Match("golang", Q.NaturalMode)})
+//
+func (p *SimpleTable) QueryWith(opts []Q.Option, fieldNames []string, where ...WhereMap) (rows *Rows, err error)  {
+	return p.query("QueryWith", opts, fieldNames, where)
+}
+
+// query runs the select built with `opts` for `method`
+func (p *SimpleTable) query(method string, opts []Q.Option, fieldNames []string, where []WhereMap) (rows *Rows, err error)  {
+	whereMap := p.merge(where)
+	query, args := BuildQuerySQLFor(p.dialect, p.table, whereMap, fieldNames, Q.Limit{}, opts...)
+	cols := func() []string {
+		return queryColumns(p.dialect, whereMap, opts)
+	}
+	err = p.run(OpSelect, method, query, args, cols, func(stmt *Statement, x *execution) error {
+		rs, err := p.tx.QueryxContext(x.ctx, stmt.Query, stmt.Args...)
+		rows = &Rows{Rows:rs}
+		// the rows event follows once the rows are consumed
+		x.finish(err, err == nil)
+		if err == nil {
+			rows.exec = x
+		}
+		return err
+	})
 	return rows, err
 }
 
+// merge merges conditions of a statement,
+// conflicts are sent on the bus of the table
+func (p *SimpleTable) merge(where []WhereMap) WhereMap {
+	var whereMap = WhereMap{}
+	for _, conflict := range whereMap.merge(where...) {
+		p.bus.SynSend(conflict)
+	}
+	return whereMap
+}
+
 // Use is the method to get an instance of `SimpleTable`
 // it just calls `NewSimpleTable` method to build an new instance
 // I will make `SimpleTable` objects pooled in future (maybe ^_^)
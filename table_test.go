@@ -2,117 +2,54 @@ package dbutils
 
 import (
 	"testing"
+	"time"
+	"strings"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/jmoiron/sqlx"
-	"os"
 	"fmt"
 	"github.com/argpass/dbutils/Q"
+	"github.com/argpass/dbutils/dbtest"
 	"github.com/argpass/dbutils/evt"
 )
 
 func init()  {
-	// todo: remove this constant env key here
-	os.Setenv("DBUTILS_MYSQL_DNS", "root:akun@123@(vagrant:3306)/test?charset=utf8")
-
-	evt.Subscribe((*SQLEvent)(nil),
-		evt.EventHandler(func(e evt.Event)(result interface{}){
-			if ev, ok := e.(*SQLEvent); ok{
-				fmt.Println("[SQL]:",ev.Query, ",args:",ev.Args)
-			}
-			return nil
-	        }))
-
-	ConnectAll()
-}
-
-// clean testing tx
-func clean (tx *sqlx.Tx){
-	re := recover()
-	var e error
-	var ok bool
-	if e, ok = re.(error); ok {
-		fmt.Println("panic:", e)
-		tx.Rollback()
-	}else{
-		tx.Commit()
-	}
-	if e != nil {
-		panic(e)
-	}
-}
-
-var TestMysql = true
-var mysqlDB *sqlx.DB
-
-type Scheme struct {
-	create string
-	drop string
-}
+	// statements are printed with `go test -v`
+	evt.On(nil, func(ev *SQLEvent){
+		if testing.Verbose() {
+			fmt.Println("[SQL]:",ev.Query, ",args:",ev.Args)
+		}
+	})
 
-func (p Scheme) Mysql() (string, string) {
-	return p.create, p.drop
+	// tests run with SQLite, and MySQL if `DBUTILS_MYSQL_DSN` is set
+	dbtest.RegisterFromEnv()
 }
 
 var t_book = "dbutils_t_book"
 
-var test_scheme = Scheme{
-	create:
-	`CREATE TABLE dbutils_t_book(id INTEGER AUTO_INCREMENT PRIMARY KEY,name VARCHAR(100) NOT NULL,
+var test_scheme = dbtest.Schema{
+	Create: map[Q.Dialect]string{
+		Q.MySQL: `CREATE TABLE dbutils_t_book(id INTEGER AUTO_INCREMENT PRIMARY KEY,name VARCHAR(100) NOT NULL,
 	tag TINYINT NULL, deleted BOOLEAN DEFAULT FALSE)`,
-	drop:"drop table dbutils_t_book",
-}
-
-type testFunc func(db *sqlx.DB, t *testing.T)
-
-func RunWithScheme(scheme Scheme, t *testing.T, testFn testFunc)  {
-	runner := func(db *sqlx.DB, create string, drop string){
-		// drop tables
-		defer func(){
-			db.MustExec(drop)
-			db.Close()
-		}()
-		// prepare environment
-		db.MustExec(create)
-		// run test function
-		testFn(mysqlDB, t)
-	}
-
-	if TestMysql {
-		create, drop := scheme.Mysql()
-		runner(mysqlDB, create, drop)
-	}
-}
-
-func ConnectAll()  {
-	mysqlDNS := os.Getenv("DBUTILS_MYSQL_DNS")
-
-	if TestMysql {
-		db, err := sqlx.Open("mysql", mysqlDNS)
-		if err != nil {
-			fmt.Printf("\nfail to connect mysql, err:%v\n", err)
-			TestMysql = false
-		}
-		mysqlDB = db
-	}
+		Q.SQLite: `CREATE TABLE dbutils_t_book(id INTEGER PRIMARY KEY AUTOINCREMENT,name VARCHAR(100) NOT NULL,
+	tag TINYINT NULL, deleted BOOLEAN DEFAULT FALSE)`,
+	},
+	Drop: map[Q.Dialect]string{
+		Q.MySQL: "DROP TABLE IF EXISTS dbutils_t_book",
+	},
 }
 
 func TestSimpleTable_Insert(t *testing.T) {
-	RunWithScheme(test_scheme, t, func(db *sqlx.DB, t *testing.T){
-		tx, _ := db.Beginx()
-		defer clean(tx)
+	dbtest.Run(t, test_scheme, func(t *testing.T, tx *sqlx.Tx){
 		table := NewSimpleTable(tx, t_book)
 		_, err := table.Insert(FieldMap{"name": "Python"})
 		if err != nil {
 			t.Fatalf("\n[insert] err:%v\n", err)
 		}
-		tx.Commit()
 	})
 }
 
 func TestSimpleTable_Get(t *testing.T) {
-	RunWithScheme(test_scheme, t, func(db *sqlx.DB, t *testing.T){
-		tx, _ := db.Beginx()
-		defer clean(tx)
+	dbtest.Run(t, test_scheme, func(t *testing.T, tx *sqlx.Tx){
 		table := NewSimpleTable(tx, t_book)
 		table.Insert(FieldMap{"name": "Python", "tag": 1, "deleted": true})
 		table.Insert(FieldMap{"name": "Golang"})
@@ -140,14 +77,57 @@ func TestSimpleTable_Get(t *testing.T) {
 		if len(rs) != 0 {
 			t.Fatalf("\n[get] expect 0 row got %d\n", len(rs))
 		}
-		tx.Commit()
+	})
+}
+
+func TestSimpleTable_RowsEvent(t *testing.T) {
+	dbtest.Run(t, test_scheme, func(t *testing.T, tx *sqlx.Tx){
+		var events []evt.Event
+		bus := evt.NewBus()
+		bus.SubscribeAll(func(e evt.Event) interface{} {
+			events = append(events, e)
+			return nil
+		})
+		table := NewSimpleTable(tx, t_book).UseBus(bus)
+		table.Insert(FieldMap{"name": "Python"})
+		table.Insert(FieldMap{"name": "Golang"})
+		events = nil
+
+		// the event of a row never scanned is sent anyway
+		if _, err := table.Get(nil, WhereMap{"name": Q.EQ("Python")}); err != nil {
+			t.Fatalf("\n[get] err:%v\n", err)
+		}
+		if len(events) != 1 {
+			t.Fatalf("\n expect 1 event got %d: %v\n", len(events), events)
+		}
+		if ev, ok := events[0].(*SQLEvent); !ok || !ev.RowsPending || ev.Duration <= 0 {
+			t.Fatalf("\n expect SQLEvent with rows pending got %+v\n", events[0])
+		}
+
+		// the event of a query is sent before rows are read
+		events = nil
+		rows, err := table.Query(nil)
+		if err != nil {
+			t.Fatalf("\n[query] err:%v\n", err)
+		}
+		if len(events) != 1 {
+			t.Fatalf("\n expect 1 event got %d: %v\n", len(events), events)
+		}
+		for rows.Next() {
+		}
+		rows.Close()
+		if len(events) != 2 {
+			t.Fatalf("\n expect 2 events got %d: %v\n", len(events), events)
+		}
+		ev, ok := events[1].(*RowsEvent)
+		if !ok || ev.Event.Rows != 2 || ev.Event.Query != events[0].(*SQLEvent).Query || ev.Error != nil {
+			t.Fatalf("\n expect RowsEvent of 2 rows got %+v\n", events[1])
+		}
 	})
 }
 
 func TestResult_GetXXX(t *testing.T) {
-	RunWithScheme(test_scheme, t, func(db *sqlx.DB, t *testing.T){
-		tx, _ := db.Beginx()
-		defer clean(tx)
+	dbtest.Run(t, test_scheme, func(t *testing.T, tx *sqlx.Tx){
 		table := NewSimpleTable(tx, t_book)
 		table.Insert(FieldMap{"name": "Python", "tag": 1, "deleted": true})
 		table.Insert(FieldMap{"name": "Golang"})
@@ -186,14 +166,89 @@ func TestResult_GetXXX(t *testing.T) {
 			t.Fatalf("\n invalid tag value :%d\n", tag)
 		}
 
-		tx.Commit()
 	})
 }
 
+func TestResult_GetTyped(t *testing.T) {
+	r := Result{
+		"price": []byte("12.50"), "ratio": 0.25, "count": int64(3), "big": []byte("18446744073709551615"),
+		"neg": int64(-1), "created": []byte("2017-03-01 10:20:30"), "day": "2017-03-01",
+		"at": time.Date(2017, 3, 1, 0, 0, 0, 0, time.UTC), "amount": []byte("-1234567890.123456789"),
+		"elapsed": []byte("-838:59:59.5"), "interval": "1 day 02:00:00", "timeout": int64(30),
+		"days": "2 days", "mixed": "-1 days +02:00:00", "months": "1 mon",
+	}
+	if f, err := r.GetFloat64("price"); err != nil || f != 12.5 {
+		t.Fatalf("bad float %v, err:%v", f, err)
+	}
+	if f, err := r.GetFloat64("count"); err != nil || f != 3 {
+		t.Fatalf("bad float %v, err:%v", f, err)
+	}
+	if f, err := (Result{"unsigned": uint64(1 << 63)}).GetFloat64("unsigned"); err != nil || f != 1 << 63 {
+		t.Fatalf("bad float %v, err:%v", f, err)
+	}
+	if _, err := r.GetFloat64("at"); err == nil || !strings.Contains(err.Error(), "`at`") {
+		t.Fatalf("expect no float64 `at`, got %v", err)
+	}
+	if u, err := r.GetUint64("big"); err != nil || u != 18446744073709551615 {
+		t.Fatalf("bad uint %v, err:%v", u, err)
+	}
+	if _, err := r.GetUint64("neg"); err == nil {
+		t.Fatalf("expect negative error")
+	}
+	if tm, err := r.GetTime("created"); err != nil || !tm.Equal(time.Date(2017, 3, 1, 10, 20, 30, 0, time.UTC)) {
+		t.Fatalf("bad time %v, err:%v", tm, err)
+	}
+	for _, name := range []string{"day", "at"} {
+		if tm, err := r.GetTime(name); err != nil || !tm.Equal(time.Date(2017, 3, 1, 0, 0, 0, 0, time.UTC)) {
+			t.Fatalf("bad time %v, err:%v", tm, err)
+		}
+	}
+	if _, err := r.GetTime("price"); err == nil {
+		t.Fatalf("expect bad time format")
+	}
+	if d, err := r.GetDecimal("amount"); err != nil || d != "-1234567890.123456789" || d.Rat() == nil {
+		t.Fatalf("bad decimal %v, err:%v", d, err)
+	}
+	if d, err := r.GetDecimal("ratio"); err != nil || d != "0.25" {
+		t.Fatalf("bad decimal %v, err:%v", d, err)
+	}
+	if _, err := r.GetDecimal("day"); err == nil {
+		t.Fatalf("expect bad decimal")
+	}
+	expected := map[string]time.Duration{
+		"elapsed": -(838 * time.Hour + 59 * time.Minute + 59500 * time.Millisecond),
+		"interval": 26 * time.Hour,
+		"timeout": 30 * time.Second,
+		"days": 48 * time.Hour,
+		"mixed": -22 * time.Hour,
+	}
+	for name, duration := range expected {
+		if d, err := r.GetDuration(name); err != nil || d != duration {
+			t.Fatalf("bad duration %s %v, err:%v", name, d, err)
+		}
+	}
+	if _, err := r.GetDuration("months"); err == nil {
+		t.Fatalf("expect no duration of months")
+	}
+}
+
+func TestResult_GetBool(t *testing.T) {
+	r := Result{"zero": int64(0), "one": 1, "two": int64(2), "flag": true}
+	if b, err := r.GetBool("zero"); err != nil || b {
+		t.Fatalf("expect false, got %v, err:%v", b, err)
+	}
+	for _, name := range []string{"one", "flag"} {
+		if b, err := r.GetBool(name); err != nil || !b {
+			t.Fatalf("expect true of %s, got %v, err:%v", name, b, err)
+		}
+	}
+	if _, err := r.GetBool("two"); err == nil {
+		t.Fatalf("expect no bool")
+	}
+}
+
 func TestSimpleTable_Query_IN_NI(t *testing.T) {
-	RunWithScheme(test_scheme, t, func(db *sqlx.DB, t *testing.T){
-		tx, _ := db.Beginx()
-		defer clean(tx)
+	dbtest.Run(t, test_scheme, func(t *testing.T, tx *sqlx.Tx){
 		table := NewSimpleTable(tx, t_book)
 		table.Insert(FieldMap{"name": "Python"})
 		table.Insert(FieldMap{"name": "Golang"})
@@ -230,14 +285,11 @@ func TestSimpleTable_Query_IN_NI(t *testing.T) {
 		if len(rs) != 1 {
 			t.Fatalf("\n[query in] expect 2 got %d\n", len(rs))
 		}
-		tx.Commit()
 	})
 }
 
 func TestSimpleTable_Query_Null_Not_Null(t *testing.T) {
-	RunWithScheme(test_scheme, t, func(db *sqlx.DB, t *testing.T){
-		tx, _ := db.Beginx()
-		defer clean(tx)
+	dbtest.Run(t, test_scheme, func(t *testing.T, tx *sqlx.Tx){
 		table := NewSimpleTable(tx, t_book)
 		table.Insert(FieldMap{"name": "Python"})
 		table.Insert(FieldMap{"name": "Golang"})
@@ -272,14 +324,11 @@ func TestSimpleTable_Query_Null_Not_Null(t *testing.T) {
 		if len(rs) != 0 {
 			t.Fatalf("\n[query in] expect 0 got %d\n", len(rs))
 		}
-		tx.Commit()
 	})
 }
 
 func TestSimpleTable_Query_Like(t *testing.T) {
-	RunWithScheme(test_scheme, t, func(db *sqlx.DB, t *testing.T){
-		tx, _ := db.Beginx()
-		defer clean(tx)
+	dbtest.Run(t, test_scheme, func(t *testing.T, tx *sqlx.Tx){
 		table := NewSimpleTable(tx, t_book)
 		table.Insert(FieldMap{"name": "Python"})
 		table.Insert(FieldMap{"name": "Golang"})
@@ -314,14 +363,11 @@ func TestSimpleTable_Query_Like(t *testing.T) {
 		if len(rs) != 2 {
 			t.Fatalf("\n[query in] expect 2 got %d\n", len(rs))
 		}
-		tx.Commit()
 	})
 }
 
 func TestSimpleTable_Query_EQ_NE_GT_LT(t *testing.T) {
-	RunWithScheme(test_scheme, t, func(db *sqlx.DB, t *testing.T){
-		tx, _ := db.Beginx()
-		defer clean(tx)
+	dbtest.Run(t, test_scheme, func(t *testing.T, tx *sqlx.Tx){
 		table := NewSimpleTable(tx, t_book)
 		table.Insert(FieldMap{"name": "Python"})
 		table.Insert(FieldMap{"name": "Golang"})
@@ -418,14 +464,11 @@ func TestSimpleTable_Query_EQ_NE_GT_LT(t *testing.T) {
 		if len(rs) != 4 {
 			t.Fatalf("\n[query] expect 4 got %d\n", len(rs))
 		}
-		tx.Commit()
 	})
 }
 
 func TestSimpleTable_Query_Between(t *testing.T) {
-	RunWithScheme(test_scheme, t, func(db *sqlx.DB, t *testing.T){
-		tx, _ := db.Beginx()
-		defer clean(tx)
+	dbtest.Run(t, test_scheme, func(t *testing.T, tx *sqlx.Tx){
 		table := NewSimpleTable(tx, t_book)
 		table.Insert(FieldMap{"name": "Python"})
 		table.Insert(FieldMap{"name": "Golang"})
@@ -460,15 +503,12 @@ func TestSimpleTable_Query_Between(t *testing.T) {
 		if len(rs) != 1 {
 			t.Fatalf("\n[query in] expect 1 got %d\n", len(rs))
 		}
-		tx.Commit()
 	})
 }
 
 
 func TestSimpleTable_Update(t *testing.T) {
-	RunWithScheme(test_scheme, t, func(db *sqlx.DB, t *testing.T){
-		tx, _ := db.Beginx()
-		defer clean(tx)
+	dbtest.Run(t, test_scheme, func(t *testing.T, tx *sqlx.Tx){
 		table := NewSimpleTable(tx, t_book)
 		table.Insert(FieldMap{"name": "Python"})
 		table.Insert(FieldMap{"name": "Golang"})
@@ -498,9 +538,7 @@ func TestSimpleTable_Update(t *testing.T) {
 }
 
 func TestSimpleTable_Delete(t *testing.T) {
-	RunWithScheme(test_scheme, t, func(db *sqlx.DB, t *testing.T){
-		tx, _ := db.Beginx()
-		defer clean(tx)
+	dbtest.Run(t, test_scheme, func(t *testing.T, tx *sqlx.Tx){
 		table := NewSimpleTable(tx, t_book)
 		// prepare 3 rows
 		table.Insert(FieldMap{"name": "Python"})
@@ -520,14 +558,11 @@ func TestSimpleTable_Delete(t *testing.T) {
 			t.Fatalf("\n[delete] expect to delete cnt 2 got %d\n", cnt)
 		}
 
-		tx.Commit()
 	})
 }
 
 func TestQ(t *testing.T) {
-	RunWithScheme(test_scheme, t, func(db *sqlx.DB, t *testing.T){
-		tx, _ := db.Beginx()
-		defer clean(tx)
+	dbtest.Run(t, test_scheme, func(t *testing.T, tx *sqlx.Tx){
 		table := NewSimpleTable(tx, t_book)
 		// prepare 3 rows
 		table.Insert(FieldMap{"name": "Python"})
@@ -538,3 +573,28 @@ func TestQ(t *testing.T) {
 	})
 }
 
+
+func TestNewSimpleTable_NilTx(t *testing.T) {
+	table := NewSimpleTable(nil, t_book)
+	if table.Dialect() != Q.MySQL {
+		t.Fatalf("expect mysql, got %s", table.Dialect())
+	}
+	var events []*SQLEvent
+	bus := evt.NewBus()
+	evt.On(bus, func(e *SQLEvent) {
+		events = append(events, e)
+	})
+	table.UseBus(bus)
+	if _, err := table.Insert(FieldMap{"name": "Python"}); err != NO_TX {
+		t.Fatalf("expect NO_TX, got %v", err)
+	}
+	if _, err := table.Get(nil, WhereMap{"id": Q.EQ(1)}); err != NO_TX {
+		t.Fatalf("expect NO_TX, got %v", err)
+	}
+	if _, err := table.Exec("DELETE FROM " + t_book); err != NO_TX {
+		t.Fatalf("expect NO_TX, got %v", err)
+	}
+	if len(events) != 3 || !events[0].Aborted || events[0].Error != NO_TX {
+		t.Fatalf("expect 3 aborted events, got %v", events)
+	}
+}
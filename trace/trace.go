@@ -0,0 +1,113 @@
+// Package trace defines the tracer interface `dbutils` creates spans with,
+// it is shaped after OpenTelemetry so an adapter is a few lines,
+// `MemoryTracer` records spans in memory for tests
+package trace
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Attribute keys following the OpenTelemetry database conventions
+const (
+	DBSystem    = "db.system"
+	DBStatement = "db.statement"
+	DBOperation = "db.operation"
+	DBTable     = "db.sql.table"
+	// DBRows is the number of rows affected, selects end before their rows are read
+	DBRows      = "db.rows"
+	DBTxID      = "db.tx_id"
+	// DBStatements is the number of statements run in a transaction
+	DBStatements = "db.statements"
+)
+
+// Tracer starts spans as children of the span in `ctx`
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is an operation being traced
+type Span interface {
+	SetAttribute(key string, value interface{})
+	RecordError(err error)
+	End()
+}
+
+type spanKey struct{}
+
+// MemorySpan is a span recorded by `MemoryTracer`
+type MemorySpan struct {
+	lock       sync.Mutex
+	Name       string
+	ID         uint64
+	// ParentID is 0 for root spans
+	ParentID   uint64
+	Start      time.Time
+	EndTime    time.Time
+	Ended      bool
+	Attributes map[string]interface{}
+	Errors     []error
+}
+
+var _ Span = &MemorySpan{}
+
+func (s *MemorySpan) SetAttribute(key string, value interface{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.Attributes[key] = value
+}
+
+func (s *MemorySpan) RecordError(err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.Errors = append(s.Errors, err)
+}
+
+func (s *MemorySpan) End() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !s.Ended {
+		s.Ended, s.EndTime = true, time.Now()
+	}
+}
+
+// MemoryTracer records spans in memory
+type MemoryTracer struct {
+	lock   sync.Mutex
+	lastID uint64
+	spans  []*MemorySpan
+}
+
+var _ Tracer = &MemoryTracer{}
+
+// NewMemoryTracer creates an empty `MemoryTracer`
+func NewMemoryTracer() *MemoryTracer {
+	return &MemoryTracer{}
+}
+
+func (t *MemoryTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.lastID++
+	span := &MemorySpan{Name:name, ID:t.lastID, Start:time.Now(), Attributes:map[string]interface{}{}}
+	if parent, ok := ctx.Value(spanKey{}).(*MemorySpan); ok {
+		span.ParentID = parent.ID
+	}
+	t.spans = append(t.spans, span)
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// Spans returns spans started in order
+func (t *MemoryTracer) Spans() []*MemorySpan {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return append([]*MemorySpan(nil), t.spans...)
+}
+
+// Reset drops all recorded spans
+func (t *MemoryTracer) Reset() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.spans = nil
+}
@@ -0,0 +1,28 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestMemoryTracer(t *testing.T) {
+	tracer := NewMemoryTracer()
+	ctx, parent := tracer.Start(context.Background(), "transaction")
+	_, child := tracer.Start(ctx, "select t_book")
+	child.SetAttribute(DBTable, "t_book")
+	child.RecordError(errors.New("boom"))
+	child.End()
+	parent.End()
+
+	spans := tracer.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("expect 2 spans got %d", len(spans))
+	}
+	if spans[0].ParentID != 0 || spans[1].ParentID != spans[0].ID {
+		t.Fatalf("bad parent of spans: %d, %d", spans[0].ParentID, spans[1].ParentID)
+	}
+	if !spans[1].Ended || spans[1].Attributes[DBTable] != "t_book" || len(spans[1].Errors) != 1 {
+		t.Fatalf("bad span:%+v", spans[1])
+	}
+}
@@ -0,0 +1,167 @@
+package dbutils
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+	"database/sql"
+	"github.com/argpass/dbutils/Q"
+	"github.com/argpass/dbutils/evt"
+	"github.com/argpass/dbutils/trace"
+	"sync/atomic"
+	"time"
+)
+
+// lastTxID is the id of the last transaction begun in the process
+var lastTxID uint64
+
+// TxBeginEvent is triggered when a transaction begins
+type TxBeginEvent struct {
+	TxID  uint64
+	Start time.Time
+	Error error
+}
+
+// TxCommitEvent is triggered when a transaction is committed
+type TxCommitEvent struct {
+	TxID       uint64
+	Start      time.Time
+	// Duration is the time from beginning to committing
+	Duration   time.Duration
+	// Statements is the number of statements run by tables of the transaction
+	Statements int64
+	Error      error
+}
+
+// TxRollbackEvent is triggered when a transaction is rolled back
+type TxRollbackEvent struct {
+	TxID       uint64
+	Start      time.Time
+	Duration   time.Duration
+	Statements int64
+	Error      error
+}
+
+// Tx is wrapper of `sqlx.Tx` sending transaction events,
+// tables got by `Tx.Use` attach the transaction id to their sql events
+//
+// Example:
+//   tx, err := dbutils.Begin(db)
+//   if err != nil {
+//       return err
+//   }
+//   defer tx.Rollback()
+//   tx.Use("t_book").Insert(FieldMap{"name": "Python"})
+//   return tx.Commit()
+type Tx struct {
+	*sqlx.Tx
+	ID         uint64
+	Start      time.Time
+	bus        *evt.Bus
+	ctx        context.Context
+	tracer     trace.Tracer
+	span       trace.Span
+	statements int64
+	done       int32
+}
+
+// TxOptions configures a transaction begun by `BeginTx`
+type TxOptions struct {
+	// Bus receives events of the transaction and its tables, the default bus if nil
+	Bus    *evt.Bus
+	// Tracer traces the transaction as the parent span of its statements
+	Tracer trace.Tracer
+	// SQL is the isolation level and read-only options of `database/sql`
+	SQL    *sql.TxOptions
+}
+
+// Begin begins a transaction on `db` sending events to the default bus
+func Begin(db *sqlx.DB) (*Tx, error) {
+	return BeginTx(context.Background(), db, TxOptions{})
+}
+
+// BeginOn begins a transaction on `db` sending events to `bus`
+func BeginOn(bus *evt.Bus, db *sqlx.DB) (*Tx, error) {
+	return BeginTx(context.Background(), db, TxOptions{Bus:bus})
+}
+
+// BeginTx begins a transaction on `db` with `ctx`,
+// the span of the transaction is a child of the span in `ctx`
+func BeginTx(ctx context.Context, db *sqlx.DB, opts TxOptions) (*Tx, error) {
+	if opts.Bus == nil {
+		opts.Bus = evt.Default()
+	}
+	tx := &Tx{ID:atomic.AddUint64(&lastTxID, 1), Start:time.Now(), bus:opts.Bus,
+		ctx:ctx, tracer:opts.Tracer}
+	if tx.tracer != nil {
+		tx.ctx, tx.span = tx.tracer.Start(ctx, "transaction")
+		tx.span.SetAttribute(trace.DBSystem, dbSystem(Q.DialectOf(db.DriverName())))
+		tx.span.SetAttribute(trace.DBTxID, tx.ID)
+	}
+	var err error
+	tx.Tx, err = db.BeginTxx(tx.ctx, opts.SQL)
+	tx.bus.SynSend(&TxBeginEvent{TxID:tx.ID, Start:tx.Start, Error:err})
+	if err != nil {
+		tx.endSpan(err)
+		return nil, err
+	}
+	return tx, nil
+}
+
+// endSpan ends the span of the transaction
+func (tx *Tx) endSpan(err error) {
+	if tx.span == nil {
+		return
+	}
+	tx.span.SetAttribute(trace.DBStatements, tx.Statements())
+	if err != nil {
+		tx.span.RecordError(err)
+	}
+	tx.span.End()
+}
+
+// Context returns the context of the transaction holding its span
+func (tx *Tx) Context() context.Context {
+	return tx.ctx
+}
+
+// Statements returns the number of statements run in the transaction
+func (tx *Tx) Statements() int64 {
+	return atomic.LoadInt64(&tx.statements)
+}
+
+// Use gets a `SimpleTable` running in the transaction
+func (tx *Tx) Use(tableName string) *SimpleTable {
+	p := NewSimpleTable(tx.Tx, tableName).UseBus(tx.bus).UseTracer(tx.tracer)
+	p.txn, p.ctx = tx, tx.ctx
+	return p
+}
+
+// Commit commits the transaction and sends `TxCommitEvent`
+func (tx *Tx) Commit() error {
+	err := tx.Tx.Commit()
+	if !atomic.CompareAndSwapInt32(&tx.done, 0, 1) {
+		return err
+	}
+	tx.endSpan(err)
+	tx.bus.SynSend(&TxCommitEvent{TxID:tx.ID, Start:tx.Start, Duration:time.Since(tx.Start),
+		Statements:tx.Statements(), Error:err})
+	return err
+}
+
+// Rollback rolls back the transaction and sends `TxRollbackEvent`,
+// nothing is sent if the transaction is already done,
+// so it is safe to defer it
+func (tx *Tx) Rollback() error {
+	err := tx.Tx.Rollback()
+	if !atomic.CompareAndSwapInt32(&tx.done, 0, 1) {
+		return err
+	}
+	if err == sql.ErrTxDone {
+		tx.endSpan(nil)
+		return err
+	}
+	tx.endSpan(err)
+	tx.bus.SynSend(&TxRollbackEvent{TxID:tx.ID, Start:tx.Start, Duration:time.Since(tx.Start),
+		Statements:tx.Statements(), Error:err})
+	return err
+}
@@ -0,0 +1,127 @@
+package dbutils
+
+import (
+	"testing"
+	"context"
+	"strings"
+	"github.com/jmoiron/sqlx"
+	"github.com/argpass/dbutils/Q"
+	"github.com/argpass/dbutils/dbtest"
+	"github.com/argpass/dbutils/evt"
+	"github.com/argpass/dbutils/trace"
+)
+
+func TestTx_Events(t *testing.T) {
+	dbtest.RunDB(t, test_scheme, func(t *testing.T, db *sqlx.DB){
+		var events []evt.Event
+		bus := evt.NewBus()
+		bus.SubscribeAll(func(e evt.Event) interface{} {
+			events = append(events, e)
+			return nil
+		})
+
+		tx, err := BeginOn(bus, db)
+		if err != nil {
+			t.Fatalf("\n[begin] err:%v\n", err)
+		}
+		table := tx.Use(t_book)
+		table.Insert(FieldMap{"name": "Python"})
+		row, _ := table.Get(nil, WhereMap{"name": Q.EQ("Python")})
+		row.GetResult()
+		if err = tx.Commit(); err != nil {
+			t.Fatalf("\n[commit] err:%v\n", err)
+		}
+		// rolling back a committed transaction sends nothing
+		tx.Rollback()
+
+		if len(events) != 5 {
+			t.Fatalf("\n expect 5 events got %d: %v\n", len(events), events)
+		}
+		begin, ok := events[0].(*TxBeginEvent)
+		if !ok || begin.TxID != tx.ID || begin.Error != nil {
+			t.Fatalf("\n expect TxBeginEvent got %+v\n", events[0])
+		}
+		for _, e := range events[1:3] {
+			if ev, ok := e.(*SQLEvent); !ok || ev.TxID != tx.ID || ev.Error != nil {
+				t.Fatalf("\n expect SQLEvent of tx %d got %+v\n", tx.ID, e)
+			}
+		}
+		if ev, ok := events[3].(*RowsEvent); !ok || ev.Event.TxID != tx.ID || ev.Event.Rows != 1 {
+			t.Fatalf("\n expect RowsEvent of 1 row got %+v\n", events[3])
+		}
+		commit, ok := events[4].(*TxCommitEvent)
+		if !ok || commit.TxID != tx.ID || commit.Statements != 2 || commit.Duration <= 0 {
+			t.Fatalf("\n expect TxCommitEvent of 2 statements got %+v\n", events[4])
+		}
+
+		events = nil
+		tx, _ = BeginOn(bus, db)
+		tx.Use(t_book).Delete()
+		tx.Rollback()
+		tx.Rollback()
+		if len(events) != 3 {
+			t.Fatalf("\n expect 3 events got %d: %v\n", len(events), events)
+		}
+		rollback, ok := events[2].(*TxRollbackEvent)
+		if !ok || rollback.TxID != tx.ID || rollback.Statements != 1 || rollback.Error != nil {
+			t.Fatalf("\n expect TxRollbackEvent of 1 statement got %+v\n", events[2])
+		}
+		if tx.ID == begin.TxID {
+			t.Fatalf("\n expect a new tx id\n")
+		}
+	})
+}
+
+func TestTx_Trace(t *testing.T) {
+	dbtest.RunDB(t, test_scheme, func(t *testing.T, db *sqlx.DB){
+		tracer := trace.NewMemoryTracer()
+		tx, err := BeginTx(context.Background(), db, TxOptions{Tracer:tracer})
+		if err != nil {
+			t.Fatalf("\n[begin] err:%v\n", err)
+		}
+		table := tx.Use(t_book)
+		if _, err = table.Insert(FieldMap{"name": "Python"}); err != nil {
+			t.Fatalf("\n[insert] err:%v\n", err)
+		}
+		if _, err = table.Insert(FieldMap{"no_such_column": 1}); err == nil {
+			t.Fatalf("\n expect error of unknown column\n")
+		}
+		// the span of a row never scanned is ended anyway
+		if _, err = table.Get(nil, WhereMap{"name": Q.EQ("Python")}); err != nil {
+			t.Fatalf("\n[get] err:%v\n", err)
+		}
+		tx.Rollback()
+
+		spans := tracer.Spans()
+		if len(spans) != 4 {
+			t.Fatalf("\n expect 4 spans got %d\n", len(spans))
+		}
+		if get := spans[3]; get.Name != "select " + t_book || !get.Ended {
+			t.Fatalf("\n expect an ended select span got %+v\n", get)
+		}
+		spans = spans[:3]
+		txSpan := spans[0]
+		system := dbSystem(Q.DialectOf(db.DriverName()))
+		if txSpan.Name != "transaction" || !txSpan.Ended || txSpan.Attributes[trace.DBSystem] != system ||
+			txSpan.Attributes[trace.DBTxID] != tx.ID || txSpan.Attributes[trace.DBStatements] != int64(3) {
+			t.Fatalf("\n bad tx span:%+v\n", txSpan)
+		}
+		for _, span := range spans[1:] {
+			if span.ParentID != txSpan.ID || !span.Ended {
+				t.Fatalf("\n expect an ended child of the tx span got %+v\n", span)
+			}
+			if span.Name != "insert " + t_book || span.Attributes[trace.DBSystem] != system ||
+				span.Attributes[trace.DBOperation] != "INSERT" || span.Attributes[trace.DBTable] != t_book ||
+				span.Attributes[trace.DBTxID] != tx.ID {
+				t.Fatalf("\n bad statement span:%+v\n", span)
+			}
+			if statement, _ := span.Attributes[trace.DBStatement].(string); !strings.HasPrefix(statement, "INSERT INTO " + t_book) {
+				t.Fatalf("\n bad statement:%v\n", span.Attributes[trace.DBStatement])
+			}
+		}
+		if len(spans[1].Errors) != 0 || len(spans[2].Errors) != 1 {
+			t.Fatalf("\n expect an error on the failing statement only, got %v, %v\n",
+				spans[1].Errors, spans[2].Errors)
+		}
+	})
+}
@@ -6,6 +6,8 @@ import (
 	"strings"
 	"fmt"
 	"github.com/argpass/dbutils/Q"
+	"github.com/argpass/dbutils/evt"
+	"github.com/argpass/dbutils/internal/sorted"
 )
 
 ////////////////////// matrix /////////////////////
@@ -70,17 +72,62 @@ func (m *matrix) NumElem() int {
 
 type WhereMap map[string] Q.Caller
 
+// WhereConflictEvent is triggered when `WhereMap.Merge` overwrites
+// the condition already set on a field,
+// `SimpleTable` sends it on its own bus for the conditions of a statement.
+// Subscribe it to get warned, use `Q.All` or `WhereMap.And`
+// to keep both conditions instead.
+type WhereConflictEvent struct {
+	Field string
+	Old   Q.Caller
+	New   Q.Caller
+}
+
 // Merge others
+// a condition of others overwrites the one on the same field,
+// `WhereConflictEvent` is sent on the default bus when that happens
 func (where WhereMap) Merge(others... WhereMap) {
+	for _, conflict := range where.merge(others...) {
+		evt.SynSend(conflict)
+	}
+}
+
+// merge merges others and returns the overwrites as conflicts
+func (where WhereMap) merge(others... WhereMap) (conflicts []*WhereConflictEvent) {
 	for _, other := range others {
-		for k, v := range other {
+		for _, k := range sorted.Keys(other) {
+			v := other[k]
+			if old, ok := where[k]; ok {
+				conflicts = append(conflicts, &WhereConflictEvent{Field:k, Old:old, New:v})
+			}
 			where[k] = v
 		}
 	}
+	return conflicts
+}
+
+// And adds conditions on `name` with AND,
+// the condition already set on `name` is kept
+//
+// Example:
+//   // age >= ? AND age < ?
+//   where := WhereMap{"age": Q.GTE(18)}
+//   where.And("age", Q.LT(65))
+func (where WhereMap) And(name string, callers... Q.Caller) WhereMap {
+	if old, ok := where[name]; ok {
+		callers = append([]Q.Caller{old}, callers...)
+	}
+	if len(callers) == 1 {
+		where[name] = callers[0]
+	}else {
+		where[name] = Q.All(callers...)
+	}
+	return where
 }
 
 // FieldMap is defined to manage fields map easily
 // key is field name in db
+// a `Q.Setter` value such as `Q.JSONSet` renders its own expression on update
 type FieldMap map[string] interface{}
 
 // Merge others
@@ -104,7 +151,13 @@ func (fm FieldMap) Merge(others... FieldMap) {
 //      ("v1","v1"), ("v2","v2"),("v3","v3");
 type FieldValuesMap map[string][]interface{}
 
+// BuildWhereBlock builds the WHERE block for MySQL
 func (w WhereMap) BuildWhereBlock(argsReceiver []interface{}) (block string, args []interface{}, ok bool) {
+	return w.BuildWhereBlockFor(Q.MySQL, argsReceiver)
+}
+
+// BuildWhereBlockFor builds the WHERE block rendered for `dialect`
+func (w WhereMap) BuildWhereBlockFor(dialect Q.Dialect, argsReceiver []interface{}) (block string, args []interface{}, ok bool) {
 	args = argsReceiver
 	// build sql string
 	if len(w) == 0 {
@@ -112,11 +165,12 @@ func (w WhereMap) BuildWhereBlock(argsReceiver []interface{}) (block string, arg
 	}
 	// build where block
 	var whereSlice []string
-	for name, caller := range w {
-		block, args = caller.Call(name, args)
+	for _, name := range sorted.Keys(w) {
+		caller := w[name]
+		block, args = Q.Render(caller, dialect, name, args)
 		whereSlice = append(whereSlice, block)
 	}
-	block = strings.Join([]string{"WHERE", strings.Join(whereSlice, "AND")}, " ")
+	block = strings.Join([]string{"WHERE", strings.Join(whereSlice, " AND ")}, " ")
 	ok = true
 	return block, args, ok
 }
@@ -124,13 +178,26 @@ func (w WhereMap) BuildWhereBlock(argsReceiver []interface{}) (block string, arg
 // BuildUpdateSQL builds SQL for updating rows
 func BuildUpdateSQL(table string, fieldsMap FieldMap,
 		whereMap WhereMap) (query string, args []interface{}, err error)  {
+	return BuildUpdateSQLFor(Q.MySQL, table, fieldsMap, whereMap)
+}
+
+// BuildUpdateSQLFor builds SQL for updating rows rendered for `dialect`
+func BuildUpdateSQLFor(dialect Q.Dialect, table string, fieldsMap FieldMap,
+		whereMap WhereMap) (query string, args []interface{}, err error)  {
 	if len(fieldsMap) == 0 {
 		err = NO_UPDATE_FIELDS
 		return "", nil, err
 	}
 	// build set block
 	var setSlice []string
-	for name, value := range fieldsMap {
+	for _, name := range sorted.Keys(fieldsMap) {
+		value := fieldsMap[name]
+		if setter, ok := value.(Q.Setter); ok {
+			var expr string
+			expr, args = setter.Set(dialect, name, args)
+			setSlice = append(setSlice, strings.Join([]string{name, expr}, "="))
+			continue
+		}
 		setSlice = append(setSlice, strings.Join([]string{name,"?"}, "="))
 		args = append(args, value)
 	}
@@ -139,7 +206,7 @@ func BuildUpdateSQL(table string, fieldsMap FieldMap,
 	// build sql string
 	var whereBlock string
 	var ok bool
-	if whereBlock, args, ok = whereMap.BuildWhereBlock(args); ok {
+	if whereBlock, args, ok = whereMap.BuildWhereBlockFor(dialect, args); ok {
 		query = strings.Join([]string{"UPDATE", table, "SET", setBlock, whereBlock}, " ")
 	}else {
 		query = strings.Join([]string{"UPDATE", table, "SET", setBlock}, " ")
@@ -149,9 +216,14 @@ func BuildUpdateSQL(table string, fieldsMap FieldMap,
 
 // BuildDeleteSQL builds SQL for deleting rows
 func BuildDeleteSQL(table string, where WhereMap)(query string, args []interface{}) {
+	return BuildDeleteSQLFor(Q.MySQL, table, where)
+}
+
+// BuildDeleteSQLFor builds SQL for deleting rows rendered for `dialect`
+func BuildDeleteSQLFor(dialect Q.Dialect, table string, where WhereMap)(query string, args []interface{}) {
 	var whereBlock string
 	var ok bool
-	if whereBlock, args, ok = where.BuildWhereBlock(args); ok {
+	if whereBlock, args, ok = where.BuildWhereBlockFor(dialect, args); ok {
 		query = strings.Join([]string{"DELETE", "FROM", table, whereBlock}, " ")
 	}else {
 		query = strings.Join([]string{"DELETE", "FROM", table}, " ")
@@ -163,7 +235,8 @@ func BuildDeleteSQL(table string, where WhereMap)(query string, args []interface
 func BuildInsertSQL(table string, fieldsMap FieldMap) (query string, args []interface{}, err error) {
 	var fieldsSlice []string
 	var valuesSlice []string
-	for field, value := range fieldsMap {
+	for _, field := range sorted.Keys(fieldsMap) {
+		value := fieldsMap[field]
 		fieldsSlice = append(fieldsSlice, field)
 		valuesSlice = append(valuesSlice, "?")
 		args = append(args, value)
@@ -190,7 +263,8 @@ func BuildInsertSQL(table string, fieldsMap FieldMap) (query string, args []inte
 func BuildInsertManySQL(table string, fieldValues FieldValuesMap) (query string, args[]interface{}, err error) {
 	var fieldNames []string
 	m, _ := buildMatrix()
-	for name, values := range fieldValues {
+	for _, name := range sorted.Keys(fieldValues) {
+		values := fieldValues[name]
 		m.AddRow(values)
 		fieldNames = append(fieldNames, name)
 	}
@@ -228,27 +302,53 @@ func BuildInsertManySQL(table string, fieldValues FieldValuesMap) (query string,
 }
 
 // BuildQuerySQL builds sql for querying rows match `where`
-// todo: support order by, asc/desc, name as,... options
+// `opts` select extra columns and sort rows
 func BuildQuerySQL(table string, where WhereMap,
-		fieldNames []string, limit Q.Limit) (query string, args []interface{})  {
+		fieldNames []string, limit Q.Limit, opts ...Q.Option) (query string, args []interface{})  {
+	return BuildQuerySQLFor(Q.MySQL, table, where, fieldNames, limit, opts...)
+}
+
+// BuildQuerySQLFor builds sql for querying rows rendered for `dialect`
+func BuildQuerySQLFor(dialect Q.Dialect, table string, where WhereMap,
+		fieldNames []string, limit Q.Limit, opts ...Q.Option) (query string, args []interface{})  {
+	var columns []string
+	var orderBy Q.OrderBy
+	for _, opt := range opts {
+		switch o := opt.(type) {
+		case Q.Column:
+			var column string
+			column, args = o.Column(dialect, args)
+			columns = append(columns, column)
+		case Q.OrderBy:
+			orderBy = append(orderBy, o...)
+		}
+	}
 	if len(fieldNames) == 0 {
 		fieldNames = append(fieldNames, "*")
 	}
-	fields := strings.Join(fieldNames, ",")
+	fields := strings.Join(append(fieldNames[:len(fieldNames):len(fieldNames)], columns...), ",")
 	blocks := []string{fmt.Sprintf("SELECT %s FROM %s", fields, table)}
 
 	var whereBlock string
 	var ok bool
-	if whereBlock, args, ok = where.BuildWhereBlock(args); ok {
+	if whereBlock, args, ok = where.BuildWhereBlockFor(dialect, args); ok {
 		blocks = append(blocks, whereBlock)
 	}
 
+	if len(orderBy) > 0 {
+		blocks = append(blocks, orderBy.Block())
+	}
+
 	if ! limit.IsEmpty() {
-		limitBlock := fmt.Sprintf(" LIMIT %d, %d", limit.Begin(), limit.MaxNum())
+		var limitBlock string
+		if dialect == Q.Postgres {
+			limitBlock = fmt.Sprintf("LIMIT %d OFFSET %d", limit.MaxNum(), limit.Begin())
+		}else {
+			limitBlock = fmt.Sprintf("LIMIT %d, %d", limit.Begin(), limit.MaxNum())
+		}
 		blocks = append(blocks, limitBlock)
 	}
 
 	query = strings.Join(blocks, " ")
 	return query, args
 }
-
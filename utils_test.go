@@ -2,6 +2,11 @@ package dbutils
 
 import (
 	"testing"
+	"fmt"
+	"database/sql/driver"
+	"github.com/argpass/dbutils/Q"
+	"github.com/argpass/dbutils/dbtest"
+	"github.com/argpass/dbutils/evt"
 )
 
 func TestBuildInsertSQL(t *testing.T) {
@@ -91,3 +96,196 @@ func TestMatrix_Transpose(t *testing.T) {
 		t.Fatalf("transpose fail")
 	}
 }
+
+func TestBuildQuerySQL_All(t *testing.T) {
+	where := WhereMap{"age": Q.All(Q.GTE(18), Q.LT(65))}
+	query, args := BuildQuerySQL("t_table", where, nil, Q.Limit{})
+	t.Logf("query:%s", query)
+	if query != "SELECT * FROM t_table WHERE (age  >= ? AND age  < ?)" {
+		t.Fatalf("bad query:%s", query)
+	}
+	if len(args) != 2 || args[0] != 18 || args[1] != 65 {
+		t.Fatalf("args is wrong:%v", args)
+	}
+}
+
+func TestWhereMap_And(t *testing.T) {
+	where := WhereMap{"age": Q.GTE(18)}
+	where.And("age", Q.LT(65))
+	_, args, ok := where.BuildWhereBlock(nil)
+	if !ok {
+		t.Fatalf("expect where block")
+	}
+	if len(args) != 2 || args[0] != 18 || args[1] != 65 {
+		t.Fatalf("args is wrong:%v", args)
+	}
+}
+
+func TestWhereMap_Merge_Conflict(t *testing.T) {
+	var conflicts []string
+	sub := evt.On(nil, func(ev *WhereConflictEvent) {
+		conflicts = append(conflicts, ev.Field)
+	})
+	defer sub.Unsubscribe()
+	where := WhereMap{"age": Q.GTE(18)}
+	where.Merge(WhereMap{"name": Q.EQ("Python")}, WhereMap{"age": Q.LT(65)})
+	if len(conflicts) != 1 || conflicts[0] != "age" {
+		t.Fatalf("expect conflict on age, got %v", conflicts)
+	}
+}
+
+func TestSimpleTable_Merge_Conflict(t *testing.T) {
+	var conflicts []string
+	bus := evt.NewBus()
+	evt.On(bus, func(ev *WhereConflictEvent) {
+		conflicts = append(conflicts, ev.Field)
+	})
+	leaked := 0
+	sub := evt.On(nil, func(ev *WhereConflictEvent) {
+		leaked++
+	})
+	defer sub.Unsubscribe()
+	table := NewSimpleTable(nil, "t_book").UseBus(bus)
+	table.merge([]WhereMap{{"age": Q.GTE(18)}, {"age": Q.LT(65)}})
+	if len(conflicts) != 1 || conflicts[0] != "age" || leaked != 0 {
+		t.Fatalf("expect conflict on age of the table bus only, got %v, %d leaked", conflicts, leaked)
+	}
+}
+
+func TestBuildQuerySQLFor_Like(t *testing.T) {
+	where := WhereMap{"name": Q.StartsWith("50%_off")}
+	query, args := BuildQuerySQLFor(Q.MySQL, "t_table", where, nil, Q.Limit{})
+	t.Logf("query:%s", query)
+	if query != "SELECT * FROM t_table WHERE name LIKE ? ESCAPE '!'" {
+		t.Fatalf("bad query:%s", query)
+	}
+	if args[0] != "50!%!_off%" {
+		t.Fatalf("args is wrong:%v", args)
+	}
+
+	where = WhereMap{"name": Q.IContains("Py")}
+	query, args = BuildQuerySQLFor(Q.Postgres, "t_table", where, nil, Q.Limit{10})
+	if query != "SELECT * FROM t_table WHERE name ILIKE ? ESCAPE '!' LIMIT 10 OFFSET 0" {
+		t.Fatalf("bad query:%s", query)
+	}
+	query, args = BuildQuerySQLFor(Q.SQLite, "t_table", where, nil, Q.Limit{})
+	if query != "SELECT * FROM t_table WHERE LOWER(name) LIKE LOWER(?) ESCAPE '!'" {
+		t.Fatalf("bad query:%s", query)
+	}
+	if args[0] != "%Py%" {
+		t.Fatalf("args is wrong:%v", args)
+	}
+}
+
+func TestBuildQuerySQL_IN(t *testing.T) {
+	query, args := BuildQuerySQL("t_table", WhereMap{"id": Q.IN([]int64{1, 2})}, nil, Q.Limit{})
+	if query != "SELECT * FROM t_table WHERE id IN (?,?)" {
+		t.Fatalf("bad query:%s", query)
+	}
+	if len(args) != 2 || args[0] != int64(1) || args[1] != int64(2) {
+		t.Fatalf("args is wrong:%v", args)
+	}
+
+	query, args = BuildQuerySQL("t_table", WhereMap{"id": Q.IN(nil)}, nil, Q.Limit{})
+	if query != "SELECT * FROM t_table WHERE 1 = 0" || len(args) != 0 {
+		t.Fatalf("bad query:%s, args:%v", query, args)
+	}
+
+	query, args = BuildQuerySQL("t_table", WhereMap{"name": Q.NI([]string{})}, nil, Q.Limit{})
+	if query != "SELECT * FROM t_table WHERE 1 = 1" || len(args) != 0 {
+		t.Fatalf("bad query:%s, args:%v", query, args)
+	}
+}
+
+func TestBuildQuerySQLFor_JSON(t *testing.T) {
+	where := WhereMap{"doc": Q.JSONPath("$.author.name", Q.EQ("Rob"))}
+	query, args := BuildQuerySQLFor(Q.MySQL, "t_table", where, nil, Q.Limit{})
+	if query != "SELECT * FROM t_table WHERE JSON_UNQUOTE(JSON_EXTRACT(doc, ?))  = ?" {
+		t.Fatalf("bad query:%s", query)
+	}
+	if args[0] != "$.author.name" || args[1] != "Rob" {
+		t.Fatalf("args is wrong:%v", args)
+	}
+
+	where = WhereMap{"doc": Q.JSONLength("tags[0]", Q.GT(1))}
+	query, args = BuildQuerySQLFor(Q.Postgres, "t_table", where, nil, Q.Limit{})
+	if query != `SELECT * FROM t_table WHERE jsonb_array_length(doc #> CAST(? AS text[]))  > ?` {
+		t.Fatalf("bad query:%s", query)
+	}
+	if args[0] != `{"tags","0"}` {
+		t.Fatalf("args is wrong:%v", args)
+	}
+}
+
+func TestBuildQuerySQLFor_JSONContainsSQLite(t *testing.T) {
+	db := dbtest.Open(t, dbtest.SQLite(), dbtest.Schema{Create: map[Q.Dialect]string{
+		Q.SQLite: "CREATE TABLE t_doc(id INTEGER PRIMARY KEY, doc TEXT)",
+	}})
+	db.MustExec(`INSERT INTO t_doc (id, doc) VALUES (1, '{"tags":["go","sql"],"price":10}'),
+		(2, '["go","rust"]'), (3, '{"price":12}')`)
+	for _, c := range []struct {
+		v      interface{}
+		expect []int64
+	}{
+		{map[string]interface{}{"price":10}, []int64{1}},
+		{map[string]interface{}{"tags":[]string{"go","sql"}}, []int64{1}},
+		{[]string{"go"}, []int64{2}},
+		{"rust", []int64{2}},
+		{map[string]interface{}{"price":10, "tags":[]string{"c"}}, nil},
+	} {
+		query, args := BuildQuerySQLFor(Q.SQLite, "t_doc", WhereMap{"doc": Q.JSONContains(c.v)}, []string{"id"}, Q.Limit{})
+		var ids []int64
+		if err := db.Select(&ids, query + " ORDER BY id", args...); err != nil {
+			t.Fatalf("query:%s, err:%v", query, err)
+		}
+		if fmt.Sprint(ids) != fmt.Sprint(c.expect) {
+			t.Fatalf("expect %v containing %v, got %v", c.expect, c.v, ids)
+		}
+	}
+}
+
+func TestBuildUpdateSQLFor_JSON(t *testing.T) {
+	query, args, err := BuildUpdateSQLFor(Q.Postgres, "t_table",
+		FieldMap{"doc": Q.JSONSet("$.price", 10)}, WhereMap{"id": Q.EQ(1)})
+	if err != nil {
+		t.Fatalf("err:%v", err)
+	}
+	if query != "UPDATE t_table SET doc=jsonb_set(doc, CAST(? AS text[]), CAST(? AS jsonb)) WHERE id  = ?" {
+		t.Fatalf("bad query:%s", query)
+	}
+	if len(args) != 3 || args[2] != 1 {
+		t.Fatalf("args is wrong:%v", args)
+	}
+	v, err := args[1].(driver.Valuer).Value()
+	if err != nil || v != "10" {
+		t.Fatalf("bad json value:%v, err:%v", v, err)
+	}
+}
+
+func TestBuildQuerySQLFor_Match(t *testing.T) {
+	where := WhereMap{"title,body": Q.Match("golang", Q.NaturalMode)}
+	score := Q.MatchScore("score", "title,body", "golang", Q.NaturalMode)
+	query, args := BuildQuerySQLFor(Q.MySQL, "t_book", where, []string{"id"}, Q.Limit{5},
+		score, Q.OrderBy{"-score", "id"})
+	expect := "SELECT id,MATCH (title,body) AGAINST (? IN NATURAL LANGUAGE MODE) AS score FROM t_book " +
+		"WHERE MATCH (title,body) AGAINST (? IN NATURAL LANGUAGE MODE) ORDER BY score DESC, id LIMIT 0, 5"
+	if query != expect {
+		t.Fatalf("bad query:%s", query)
+	}
+	if len(args) != 2 {
+		t.Fatalf("args is wrong:%v", args)
+	}
+
+	query, _ = BuildQuerySQLFor(Q.Postgres, "t_book", where, nil, Q.Limit{}, score)
+	expect = "SELECT *,ts_rank(to_tsvector(concat_ws(' ', title, body)), plainto_tsquery(?)) AS score " +
+		"FROM t_book WHERE to_tsvector(concat_ws(' ', title, body)) @@ plainto_tsquery(?)"
+	if query != expect {
+		t.Fatalf("bad query:%s", query)
+	}
+
+	where = WhereMap{"t_book_fts": Q.Match(`go "sql`, Q.NaturalMode)}
+	query, args = BuildQuerySQLFor(Q.SQLite, "t_book_fts", where, nil, Q.Limit{})
+	if query != "SELECT * FROM t_book_fts WHERE t_book_fts MATCH ?" || args[0] != `"go" """sql"` {
+		t.Fatalf("bad query:%s, args:%v", query, args)
+	}
+}